@@ -0,0 +1,183 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry 一条访问日志，对应 handleRequest 处理的一个请求
+type AccessLogEntry struct {
+	// 开始处理请求的时间
+	Time          time.Time
+	RemoteAddr    string
+	Codec         codec.Type
+	ServiceMethod string
+	Seq           uint64
+	// 处理耗时，包含回复的写入
+	DurationSeconds float64
+	// 请求及回复的字节数，与 MethodStats 的统计口径相同
+	RequestBytes  uint64
+	ResponseBytes uint64
+	// 错误码名称，如 OK、NotFound，连接断开或客户端取消时为 Canceled
+	Code string
+	// AccessLogConfig.MetadataKeys 中请求携带了的元数据
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// AccessLogSink 访问日志的写入目标，需支持并发调用。
+// WriteAccessLog 在请求处理完成后同步调用，调用期间请求仍计入处理中的请求数，Shutdown 会等待其返回；
+// 在读取阶段被拒绝的请求则在连接的读取 goroutine 中调用，返回前不会读取该连接上的后续请求。
+// 写入较慢的目标（如远程日志服务）应自行缓冲并异步写入
+type AccessLogSink interface {
+	WriteAccessLog(entry *AccessLogEntry) error
+}
+
+// AccessLogConfig 访问日志配置
+type AccessLogConfig struct {
+	Sink AccessLogSink
+	// 记录的请求元数据 key，为空时不记录元数据
+	MetadataKeys []string
+	// 采样比例，取值 (0, 1)，其他值记录全部请求
+	SampleRate float64
+	// 出错的请求不受采样比例限制，总是记录
+	AlwaysLogErrors bool
+}
+
+// WithAccessLog 开启访问日志，每个请求处理完成后按配置采样并写入 cfg.Sink，Sink 为空时不开启。
+// 方法不存在、参数无法解码及超出并发上限等未进入处理的请求同样记录
+func WithAccessLog(cfg AccessLogConfig) ServerOption {
+	return func(s *Server) {
+		if cfg.Sink == nil {
+			s.accessLog = nil
+			return
+		}
+		s.accessLog = &cfg
+	}
+}
+
+// 是否记录错误码为 code 的请求
+func (cfg *AccessLogConfig) sampled(code Code) bool {
+	if cfg.SampleRate <= 0 || cfg.SampleRate >= 1 {
+		return true
+	}
+	if cfg.AlwaysLogErrors && code != CodeOK {
+		return true
+	}
+	return rand.Float64() < cfg.SampleRate
+}
+
+// 挑选需要记录的请求元数据
+func (cfg *AccessLogConfig) metadata(md map[string]string) map[string]string {
+	var res map[string]string
+	for _, key := range cfg.MetadataKeys {
+		if v, ok := md[key]; ok {
+			if res == nil {
+				res = make(map[string]string, len(cfg.MetadataKeys))
+			}
+			res[key] = v
+		}
+	}
+	return res
+}
+
+// 记录一个处理完成的请求
+func (s *Server) writeAccessLog(sc *serverConn, h *codec.Header, md map[string]string, start time.Time,
+	code Code, requestBytes, responseBytes uint64) {
+	cfg := s.accessLog
+	if cfg == nil || !cfg.sampled(code) {
+		return
+	}
+	entry := &AccessLogEntry{
+		Time:            start,
+		RemoteAddr:      sc.remoteAddr,
+		Codec:           sc.codecType,
+		ServiceMethod:   h.ServiceMethod,
+		Seq:             h.Seq,
+		DurationSeconds: time.Since(start).Seconds(),
+		RequestBytes:    requestBytes,
+		ResponseBytes:   responseBytes,
+		Code:            code.String(),
+		Metadata:        cfg.metadata(md),
+	}
+	if err := cfg.Sink.WriteAccessLog(entry); err != nil {
+		sc.logger.Warn("rpc server: write access log error", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+	}
+}
+
+// AccessLogWriter 将每条访问日志编码为一行 json 写入 w
+type AccessLogWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewAccessLogWriter 新建写入 w 的 AccessLogWriter
+func NewAccessLogWriter(w io.Writer) *AccessLogWriter {
+	return &AccessLogWriter{enc: json.NewEncoder(w)}
+}
+
+func (a *AccessLogWriter) WriteAccessLog(entry *AccessLogEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enc.Encode(entry)
+}
+
+// AccessLogFile 以 json lines 格式追加写入文件的访问日志。
+// 外部工具（如 logrotate）移走文件后调用 Reopen，之后的日志写入新建的同名文件
+type AccessLogFile struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+}
+
+// OpenAccessLogFile 以追加方式打开 path，文件不存在时新建
+func OpenAccessLogFile(path string) (*AccessLogFile, error) {
+	a := &AccessLogFile{path: path}
+	if err := a.Reopen(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reopen 关闭当前文件并重新打开 path，通常在收到 SIGHUP 等轮转信号时调用
+func (a *AccessLogFile) Reopen() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old := a.f
+	a.f, a.enc = f, json.NewEncoder(f)
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func (a *AccessLogFile) WriteAccessLog(entry *AccessLogEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return os.ErrClosed
+	}
+	return a.enc.Encode(entry)
+}
+
+// Close 关闭文件，之后的写入返回 os.ErrClosed
+func (a *AccessLogFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f, a.enc = nil, nil
+	return err
+}
@@ -0,0 +1,148 @@
+package GbankRPC
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 将访问日志保存在内存中
+type memoryAccessLog struct {
+	mu      sync.Mutex
+	entries []AccessLogEntry
+}
+
+func (m *memoryAccessLog) WriteAccessLog(entry *AccessLogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+// 访问日志在回复之后写入，等待 n 条日志
+func (m *memoryAccessLog) wait(t *testing.T, n int) []AccessLogEntry {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		m.mu.Lock()
+		if len(m.entries) >= n {
+			res := append([]AccessLogEntry(nil), m.entries...)
+			m.mu.Unlock()
+			return res
+		}
+		m.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect %d access log entries", n)
+	return nil
+}
+
+func startAccessLogServer(t *testing.T, cfg AccessLogConfig) *Client {
+	s := NewServer(WithAccessLog(cfg))
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	_assert(s.RegisterService(new(PanicFoo)) == nil, "failed to register PanicFoo")
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	go s.Accept(ls)
+	t.Cleanup(func() { s.Close() })
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("entry", func(t *testing.T) {
+		sink := &memoryAccessLog{}
+		client := startAccessLogServer(t, AccessLogConfig{Sink: sink, MetadataKeys: []string{"user", "missing"}})
+
+		ctx := AppendMetadata(context.Background(), "user", "alice", "token", "secret")
+		var reply int
+		err := client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil, "call failed: %v", err)
+
+		entry := sink.wait(t, 1)[0]
+		_assert(entry.ServiceMethod == "Foo.Sum" && entry.Seq > 0 && entry.Code == "OK",
+			"unexpected entry %+v", entry)
+		_assert(entry.RemoteAddr != "" && entry.Codec == DefaultOption.CodecType, "unexpected conn info %+v", entry)
+		_assert(entry.RequestBytes > 0 && entry.ResponseBytes > 0 && entry.DurationSeconds > 0,
+			"unexpected sizes %+v", entry)
+		_assert(len(entry.Metadata) == 1 && entry.Metadata["user"] == "alice",
+			"expect only selected metadata, got %v", entry.Metadata)
+	})
+	t.Run("rejected", func(t *testing.T) {
+		sink := &memoryAccessLog{}
+		client := startAccessLogServer(t, AccessLogConfig{Sink: sink})
+
+		var reply int
+		err := client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+		err = client.Call(context.Background(), "Foo.Sum", "1+2", &reply)
+		_assert(ErrorCode(err) == CodeInvalidArgument, "expect InvalidArgument, got %v", err)
+
+		entries := sink.wait(t, 2)
+		_assert(entries[0].ServiceMethod == "Foo.Missing" && entries[0].Seq > 0 && entries[0].Code == "NotFound",
+			"unexpected entry %+v", entries[0])
+		_assert(entries[1].ServiceMethod == "Foo.Sum" && entries[1].Seq > entries[0].Seq &&
+			entries[1].Code == "InvalidArgument", "unexpected entry %+v", entries[1])
+	})
+	t.Run("sampling", func(t *testing.T) {
+		sink := &memoryAccessLog{}
+		client := startAccessLogServer(t, AccessLogConfig{Sink: sink, SampleRate: 1e-9, AlwaysLogErrors: true})
+
+		var reply int
+		for i := 0; i < 10; i++ {
+			_ = client.Call(context.Background(), "Foo.Sum", Args{}, &reply)
+		}
+		err := client.Call(context.Background(), "PanicFoo.Divide", Args{Num1: 1}, &reply)
+		_assert(ErrorCode(err) == CodeInternal, "expect Internal, got %v", err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		status, err := CheckHealth(ctx, client, "")
+		_assert(err == nil && status == StatusServing, "health check failed: %v", err)
+
+		entries := sink.wait(t, 1)
+		time.Sleep(50 * time.Millisecond)
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		_assert(len(sink.entries) == 1 && entries[0].ServiceMethod == "PanicFoo.Divide" && entries[0].Code == "Internal",
+			"expect only the failed request, got %+v", sink.entries)
+	})
+}
+
+func TestAccessLogFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenAccessLogFile(path)
+	_assert(err == nil, "open failed: %v", err)
+
+	_assert(f.WriteAccessLog(&AccessLogEntry{ServiceMethod: "Foo.Sum", Seq: 1, Code: "OK"}) == nil, "write failed")
+	// 模拟外部工具轮转日志
+	rotated := path + ".1"
+	_assert(os.Rename(path, rotated) == nil, "rename failed")
+	_assert(f.Reopen() == nil, "reopen failed")
+	_assert(f.WriteAccessLog(&AccessLogEntry{ServiceMethod: "Foo.Sum", Seq: 2, Code: "OK"}) == nil, "write failed")
+	_assert(f.Close() == nil, "close failed")
+	_assert(f.WriteAccessLog(&AccessLogEntry{}) == os.ErrClosed, "expect ErrClosed after Close")
+
+	for file, seq := range map[string]uint64{rotated: 1, path: 2} {
+		fd, err := os.Open(file)
+		_assert(err == nil, "open %s failed: %v", file, err)
+		var lines []AccessLogEntry
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			var entry AccessLogEntry
+			_assert(json.Unmarshal(scanner.Bytes(), &entry) == nil, "invalid line %q", scanner.Text())
+			lines = append(lines, entry)
+		}
+		fd.Close()
+		_assert(len(lines) == 1 && lines[0].Seq == seq, "%s: expect seq %d, got %+v", file, seq, lines)
+	}
+}
@@ -2,13 +2,13 @@ package GbankRPC
 
 import (
 	"GbankRPC/codec"
+	"GbankRPC/logging"
 	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strings"
@@ -16,7 +16,10 @@ import (
 	"time"
 )
 
-var ErrShutdown = errors.New("connection is shut down")
+var ErrShutdown = NewError(CodeUnavailable, "connection is shut down")
+
+// ErrGoAway 服务端正在关闭，客户端不再发送新请求
+var ErrGoAway = NewError(CodeUnavailable, "server is going away")
 
 type Call struct {
 	Seq           uint64
@@ -24,6 +27,12 @@ type Call struct {
 	Args          interface{}
 	Reply         interface{}
 	Err           error
+	// 随请求发送的元数据
+	Metadata map[string]string
+	// 服务端随响应返回的元数据
+	ReplyMetadata map[string]string
+	// 调用方 ctx 的截止时间，发送时换算为剩余超时时间告知服务端
+	deadline time.Time
 	// 实现异步调用，方法调用完成后存到管道内
 	Done chan *Call
 }
@@ -48,10 +57,17 @@ type Client struct {
 	mu sync.Mutex
 	// 缓存未处理的请求
 	pending map[uint64]*Call
+	logger  logging.Logger
 	// 用户主动关闭
 	closed bool
 	// 有错误等其他原因导致关闭
 	shutdown bool
+	// 服务端通知即将关闭，已发送的请求仍会等待结果
+	goAway bool
+	// 服务端握手回复，未进行握手时为 nil
+	handshake *HandshakeResponse
+	// 组合后的客户端拦截器
+	interceptor ClientInterceptor
 }
 
 // ClientResult 客户端创建结果
@@ -119,14 +135,17 @@ func dialTimeout(f newClientFunc, network, address string, opt *Option) (*Client
 
 	if opt.ConnectTimeout == 0 {
 		res := <-clientRes
-		return res.client, res.err
+		err = res.err
+		return res.client, err
 	}
 
 	select {
 	case <-time.After(opt.ConnectTimeout):
-		return nil, fmt.Errorf("dialTimeout rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+		err = fmt.Errorf("dialTimeout rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+		return nil, err
 	case res := <-clientRes:
-		return res.client, res.err
+		err = res.err
+		return res.client, err
 	}
 }
 
@@ -137,16 +156,26 @@ func parseOption(opt *Option) *Option {
 	}
 
 	opt.MagicNumber = DefaultOption.MagicNumber
+	// 旧协议不发送协议版本，服务端据此不回复握手
+	if opt.LegacyProtocol {
+		opt.ProtocolVersion = 0
+	} else if opt.ProtocolVersion == 0 {
+		opt.ProtocolVersion = DefaultOption.ProtocolVersion
+	}
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOption.CodecType
 	}
+	if opt.RPCPath == "" {
+		opt.RPCPath = DefaultOption.RPCPath
+	}
 	return opt
 }
 
 // NewHTTPClient 新建 http 客户端
 func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
+	opt = parseOption(opt)
 	// 发送 CONNECT 请求
-	io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", defaultRPCPath))
+	io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", opt.RPCPath))
 
 	// 接收服务端回复，并进行校验
 	rsp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
@@ -161,22 +190,41 @@ func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
 
 // NewClient 新建 rpc 客户端
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f, ok := codec.NewCodecFuncTable[opt.CodecType]
+	opt = parseOption(opt)
+	f, ok := codec.Lookup(opt.CodecType)
 	if !ok {
 		return nil, fmt.Errorf("NewClient invalid codec type %s", opt.CodecType)
 	}
+	f, err := codec.WithCompression(f, opt.Compression, opt.CompressThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("NewClient invalid compression %s", opt.Compression)
+	}
 
 	// 与服务端协商 option 信息
-	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("NewClient error.err is ", err)
+	if err = json.NewEncoder(conn).Encode(opt); err != nil {
+		logging.OrNop(opt.Logger).Warn("rpc client: write option error", "err", err)
 		conn.Close()
 		return nil, err
 	}
 
+	// 读取握手回复，br 中可能缓存了后续数据，编解码器需从 br 继续读取
+	br := bufio.NewReader(conn)
+	var hs *HandshakeResponse
+	if opt.ProtocolVersion > 0 {
+		if hs, err = readHandshake(conn, br, opt); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
 	client := &Client{
-		cc:      f(conn),
-		seq:     uint64(1),
-		pending: make(map[uint64]*Call),
+		cc:          f(&bufferedConn{r: br, ReadWriteCloser: conn}),
+		opt:         opt,
+		handshake:   hs,
+		interceptor: ChainClientInterceptors(opt.Interceptors...),
+		seq:         uint64(1),
+		pending:     make(map[uint64]*Call),
+		logger:      logging.OrNop(opt.Logger),
 	}
 
 	go client.receive()
@@ -191,13 +239,22 @@ func (c *Client) receive() {
 			break
 		}
 
+		if h.Control == codec.ControlGoAway {
+			c.handleGoAway(h.Seq)
+			err = c.cc.ReadBody(nil)
+			continue
+		}
+
 		call := c.removeCall(h.Seq)
+		if call != nil {
+			call.ReplyMetadata = h.Metadata
+		}
 		switch {
 		case call == nil:
 			err = c.cc.ReadBody(nil)
-		case h.Err != "":
+		case h.Err != "" || h.ErrCode != 0:
 			err = c.cc.ReadBody(nil)
-			call.Err = fmt.Errorf(h.Err)
+			call.Err = headerError(&h)
 			call.done()
 		default:
 			if err = c.cc.ReadBody(call.Reply); err != nil {
@@ -207,9 +264,26 @@ func (c *Client) receive() {
 		}
 	}
 	// 出现错误，终止全部call
+	c.logger.Debug("rpc client: connection terminated", "err", err)
 	c.terminateCalls(err)
 }
 
+// 收到服务端关闭通知，lastSeq 为服务端最后接收的请求序号，
+// 之后的请求服务端不会处理，以可重试的 ErrGoAway 结束
+func (c *Client) handleGoAway(lastSeq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.goAway = true
+	for seq, call := range c.pending {
+		if seq > lastSeq {
+			delete(c.pending, seq)
+			call.Err = ErrGoAway
+			call.done()
+		}
+	}
+}
+
 // 移除pending中指定 seq 的call，并返回
 func (c *Client) removeCall(seq uint64) *Call {
 	c.mu.Lock()
@@ -238,21 +312,48 @@ func (c *Client) terminateCalls(err error) {
 	}
 }
 
-// Call 同步调用 serviceMethod 方法
-func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := c.Go(serviceMethod, args, reply, make(chan *Call, 1))
+// Call 同步调用 serviceMethod 方法，配置了拦截器时经过拦截器调用
+// 配置了 Tracer 时为调用创建客户端 span，拦截器在 span 内执行
+func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) (err error) {
+	ctx, span := c.startSpan(ctx, serviceMethod)
+	defer func() { endSpan(span, err) }()
+
+	if c.interceptor != nil {
+		return c.interceptor(ctx, serviceMethod, args, reply, c.call)
+	}
+	return c.call(ctx, serviceMethod, args, reply)
+}
+
+// 同步调用 serviceMethod 方法
+func (c *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := c.GoContext(ctx, serviceMethod, args, reply, make(chan *Call, 1))
 
 	select {
 	case <-ctx.Done():
-		c.removeCall(call.Seq)
-		return errors.New("rpc client:call failed: " + ctx.Err().Error())
+		// 请求仍未完成时通知服务端取消处理
+		if c.removeCall(call.Seq) != nil {
+			go c.sendCancel(call.Seq)
+		}
+		return Errorf(ErrorCode(ctx.Err()), "rpc client:call failed: %s", ctx.Err())
 	case callRes := <-call.Done:
+		// 将响应元数据写入调用方通过 WithReplyMetadata 注册的 map
+		if md, ok := ctx.Value(replyMetadataKey{}).(map[string]string); ok && md != nil {
+			for k, v := range callRes.ReplyMetadata {
+				md[k] = v
+			}
+		}
 		return callRes.Err
 	}
 }
 
 // Go 异步调用 serviceMethod 方法
 func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return c.GoContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// GoContext 异步调用 serviceMethod 方法，ctx 中通过 WithMetadata 设置的元数据、链路信息及 ctx 的截止时间随请求发送
+func (c *Client) GoContext(ctx context.Context, serviceMethod string, args, reply interface{},
+	done chan *Call) *Call {
 	if done == nil || cap(done) == 0 {
 		done = make(chan *Call, 1)
 	}
@@ -261,8 +362,10 @@ func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Ca
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
+		Metadata:      injectTraceparent(ctx, OutgoingMetadata(ctx)),
 		Done:          done,
 	}
+	call.deadline, _ = ctx.Deadline()
 
 	c.send(call)
 	return call
@@ -284,6 +387,18 @@ func (c *Client) send(call *Call) {
 	c.h = &codec.Header{
 		ServiceMethod: call.ServiceMethod,
 		Seq:           seq,
+		Metadata:      call.Metadata,
+	}
+	if !call.deadline.IsZero() {
+		c.h.Timeout = time.Until(call.deadline)
+		// 已超时的请求无需发送
+		if c.h.Timeout <= 0 {
+			if itemCall := c.removeCall(seq); itemCall != nil {
+				itemCall.Err = NewError(CodeDeadlineExceeded, "rpc client: call deadline exceeded before send")
+				itemCall.done()
+			}
+			return
+		}
 	}
 
 	if err := c.cc.Write(c.h, call.Args); err != nil {
@@ -295,6 +410,22 @@ func (c *Client) send(call *Call) {
 	}
 }
 
+// 通知服务端取消 seq 对应的请求，服务端不支持时忽略
+func (c *Client) sendCancel(seq uint64) {
+	if c.handshake == nil || !c.handshake.HasFeature(FeatureCancel) {
+		return
+	}
+
+	c.sending.Lock()
+	defer c.sending.Unlock()
+
+	if !c.IsAvailable() {
+		return
+	}
+	// 发送失败说明连接已不可用，由 receive 负责终止全部请求
+	_ = c.cc.Write(&codec.Header{Seq: seq, Control: codec.ControlCancel}, invalidResponseBody)
+}
+
 // 注册call
 func (c *Client) registerCall(call *Call) (uint64, error) {
 	c.mu.Lock()
@@ -303,6 +434,9 @@ func (c *Client) registerCall(call *Call) (uint64, error) {
 	if c.shutdown || c.closed {
 		return 0, ErrShutdown
 	}
+	if c.goAway {
+		return 0, ErrGoAway
+	}
 
 	call.Seq = c.seq
 	c.pending[c.seq] = call
@@ -320,9 +454,21 @@ func (c *Client) Close() error {
 	return c.cc.Close()
 }
 
-// IsAvailable 判断客户端是否可达
+// Pending 返回已发送、尚未收到结果的请求数
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Handshake 返回服务端的握手回复，未进行握手（如 option 未携带协议版本）时返回 nil
+func (c *Client) Handshake() *HandshakeResponse {
+	return c.handshake
+}
+
+// IsAvailable 判断客户端是否可达，服务端通知即将关闭后不再可用
 func (c *Client) IsAvailable() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return !c.closed && !c.shutdown
+	return !c.closed && !c.shutdown && !c.goAway
 }
@@ -1,10 +1,17 @@
 package GbankRPC
 
 import (
+	"GbankRPC/codec"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
@@ -63,7 +70,8 @@ func TestClient_Call(t *testing.T) {
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr, &Option{})
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -89,7 +97,8 @@ func TestXDail(t *testing.T) {
 		_ = os.Remove(addr)
 		l, err := net.Listen("unix", addr)
 		if err != nil {
-			t.Fatal("failed to listen unix socket")
+			t.Error("failed to listen unix socket")
+			return
 		}
 		ch <- struct{}{}
 		s := NewServer()
@@ -99,3 +108,107 @@ func TestXDail(t *testing.T) {
 	_, err := XDial("unix@"+addr, nil)
 	_assert(err == nil, "failed to connect unix socket")
 }
+
+func TestDialHTTP_RPCPath(t *testing.T) {
+	s := NewServer(WithHTTPPaths("/custom/rpc", "/custom/debug"))
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen: %v", err)
+	defer l.Close()
+	mux := http.NewServeMux()
+	mux.Handle(s.rpcPath, s)
+	go http.Serve(l, mux)
+
+	t.Run("custom path", func(t *testing.T) {
+		client, err := DialHTTP("tcp", l.Addr().String(), &Option{RPCPath: "/custom/rpc"})
+		_assert(err == nil, "failed to dial custom path: %v", err)
+		defer client.Close()
+		var reply int
+		err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "unexpected reply %d, err %v", reply, err)
+	})
+	t.Run("default path", func(t *testing.T) {
+		_, err := DialHTTP("tcp", l.Addr().String(), nil)
+		_assert(err != nil && strings.Contains(err.Error(), "404"), "expect 404 on default path, got %v", err)
+	})
+}
+
+func TestClient_JsonCodec(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	t.Run("client", func(t *testing.T) {
+		client, err := Dial("tcp", ls.Addr().String(), &Option{CodecType: codec.JsonCodecType})
+		_assert(err == nil, "dial with json codec failed: %v", err)
+		defer client.Close()
+
+		var reply int
+		err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "expect 3, got %d, err %v", reply, err)
+	})
+	t.Run("raw wire", func(t *testing.T) {
+		// 模拟其他语言的客户端，按行收发 json
+		conn, err := net.Dial("tcp", ls.Addr().String())
+		_assert(err == nil, "dial failed: %v", err)
+		defer conn.Close()
+
+		io.WriteString(conn, `{"MagicNumber":3927900,"CodecType":"application/json"}`+"\n")
+		io.WriteString(conn, `{"ServiceMethod":"Foo.Sum","Seq":7}`+"\n"+`{"Num1":4,"Num2":5}`+"\n")
+
+		dec := json.NewDecoder(conn)
+		var h codec.Header
+		var reply int
+		_assert(dec.Decode(&h) == nil && dec.Decode(&reply) == nil, "failed to decode response")
+		_assert(h.Seq == 7 && h.Err == "" && reply == 9, "unexpected response %+v %d", h, reply)
+	})
+}
+
+func TestServer_FramedCodecMaxFrameSize(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	conn, err := net.Dial("tcp", ls.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer conn.Close()
+
+	opt := Option{MagicNumber: MagicNumber, CodecType: codec.FramedCodecType}
+	_assert(json.NewEncoder(conn).Encode(&opt) == nil, "failed to send option")
+
+	// header 正常发送，body 帧声明 2GB 长度但不发送数据
+	var header bytes.Buffer
+	_assert(gob.NewEncoder(&header).Encode(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}) == nil, "encode header")
+	frame := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], uint32(header.Len()))
+	conn.Write(append(frame, header.Bytes()...))
+	conn.Write([]byte{0, 0x7f, 0xff, 0xff, 0xff})
+
+	cc := codec.NewFramedCodec(conn)
+
+	var h codec.Header
+	_assert(cc.ReadHeader(&h) == nil && cc.ReadBody(nil) == nil, "failed to read response")
+	_assert(h.Seq == 1 && strings.Contains(h.Err, "frame too large"), "unexpected response %+v", h)
+}
+
+func TestClient_Compression(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	for _, c := range []codec.Compression{codec.CompressionGzip, codec.CompressionDeflate, codec.CompressionZlib} {
+		client, err := Dial("tcp", ls.Addr().String(), &Option{Compression: c, CompressThreshold: 1})
+		_assert(err == nil, "dial with %s failed: %v", c, err)
+
+		var reply int
+		err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "%s: expect 3, got %d, err %v", c, reply, err)
+		client.Close()
+	}
+
+	_, err := Dial("tcp", ls.Addr().String(), &Option{Compression: "br"})
+	_assert(err != nil, "unsupported compression should fail")
+}
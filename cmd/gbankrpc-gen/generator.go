@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// gbankrpcImportPath 生成代码依赖的框架包
+	gbankrpcImportPath = "GbankRPC"
+	// generatedSuffix 默认输出文件名的后缀
+	generatedSuffix = "_gbankrpc.go"
+)
+
+// serviceMethod 满足注册规则的方法，类型均为源码中的表达式
+type serviceMethod struct {
+	Name        string
+	WithContext bool
+	ArgType     string
+	// Reply 指针指向的类型
+	ReplyType string
+	// 参数类型引用的包名
+	refs []string
+}
+
+// serviceType 包含可注册方法的类型
+type serviceType struct {
+	Name    string
+	Methods []*serviceMethod
+}
+
+// generator 解析单个包并生成代码
+type generator struct {
+	fset *token.FileSet
+	// 源码所在目录，用于解析 import 的包名
+	dir     string
+	pkgName string
+	// 服务类型名到服务的映射
+	services map[string]*serviceType
+	// 参数类型引用的包，包名到 import 路径
+	imports map[string]string
+}
+
+func newGenerator() *generator {
+	return &generator{
+		fset:     token.NewFileSet(),
+		services: make(map[string]*serviceType),
+		imports:  make(map[string]string),
+	}
+}
+
+// parseDir 解析 dir 下的 go 文件，跳过测试文件及 skip 指定的文件
+func (g *generator) parseDir(dir, skip string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	g.dir = dir
+	for _, name := range files {
+		// 跳过生成的文件，避免重复生成时解析到上一次的结果
+		if strings.HasSuffix(name, "_test.go") || strings.HasSuffix(name, generatedSuffix) ||
+			filepath.Base(name) == filepath.Base(skip) {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, name, nil, 0)
+		if err != nil {
+			return err
+		}
+		if g.pkgName == "" {
+			g.pkgName = f.Name.Name
+		} else if g.pkgName != f.Name.Name {
+			return fmt.Errorf("multiple packages in %s: %s and %s", dir, g.pkgName, f.Name.Name)
+		}
+		if err := g.parseFile(f); err != nil {
+			return err
+		}
+	}
+	if g.pkgName == "" {
+		return fmt.Errorf("no go files in %s", dir)
+	}
+	return nil
+}
+
+// 收集文件中满足注册规则的方法，规则与 Service.registerMethods 一致
+func (g *generator) parseFile(f *ast.File) error {
+	fileImports := make(map[string]string)
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else {
+			name = importName(path, g.dir)
+		}
+		fileImports[name] = path
+	}
+
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+			continue
+		}
+		recv := receiverName(fn.Recv.List[0].Type)
+		if recv == "" || !ast.IsExported(recv) {
+			continue
+		}
+		method := g.parseMethod(fn, fileImports)
+		if method == nil {
+			continue
+		}
+		for _, pkg := range method.refs {
+			g.imports[pkg] = fileImports[pkg]
+		}
+
+		svc, ok := g.services[recv]
+		if !ok {
+			svc = &serviceType{Name: recv}
+			g.services[recv] = svc
+		}
+		svc.Methods = append(svc.Methods, method)
+	}
+	return nil
+}
+
+// importName 返回未指定别名的 import 在源码中使用的包名
+// 优先读取包源码中声明的包名，无法解析时按惯例去掉路径末尾的版本号
+func importName(path, srcDir string) string {
+	if pkg, err := build.Import(path, srcDir, 0); err == nil && pkg.Name != "" {
+		return pkg.Name
+	}
+	return guessImportName(path)
+}
+
+// guessImportName 按惯例由 import 路径推断包名
+func guessImportName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	// example.com/foo/v2
+	if len(elems) > 1 && strings.HasPrefix(name, "v") && isVersion(name[1:]) {
+		name = elems[len(elems)-2]
+	}
+	// gopkg.in/yaml.v3
+	if i := strings.LastIndex(name, ".v"); i > 0 && isVersion(name[i+2:]) {
+		name = name[:i]
+	}
+	return name
+}
+
+func isVersion(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 校验方法签名，不满足注册规则时返回 nil
+func (g *generator) parseMethod(fn *ast.FuncDecl, fileImports map[string]string) *serviceMethod {
+	params := flattenFields(fn.Type.Params)
+	results := flattenFields(fn.Type.Results)
+	if len(results) != 1 || !isIdent(results[0], "error") {
+		return nil
+	}
+
+	method := &serviceMethod{Name: fn.Name.Name}
+	if len(params) == 3 {
+		sel, ok := params[0].(*ast.SelectorExpr)
+		if !ok || !isIdent(sel.X, "") || sel.Sel.Name != "Context" ||
+			fileImports[sel.X.(*ast.Ident).Name] != "context" {
+			return nil
+		}
+		method.WithContext = true
+		params = params[1:]
+	}
+	if len(params) != 2 {
+		return nil
+	}
+
+	reply, ok := params[1].(*ast.StarExpr)
+	if !ok || !exportedOrBuiltin(params[0]) || !exportedOrBuiltin(params[1]) {
+		return nil
+	}
+
+	for _, expr := range []ast.Expr{params[0], reply.X} {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok && fileImports[ident.Name] != "" {
+					method.refs = append(method.refs, ident.Name)
+				}
+				return false
+			}
+			return true
+		})
+	}
+
+	method.ArgType = types.ExprString(params[0])
+	method.ReplyType = types.ExprString(reply.X)
+	return method
+}
+
+// 按参数个数展开字段列表，如 (a, b int) 展开为两个 int
+func flattenFields(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var res []ast.Expr
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			res = append(res, field.Type)
+		}
+	}
+	return res
+}
+
+// 接收者的类型名，泛型类型不支持注册，返回空
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// isIdent 判断 expr 是否为标识符 name，name 为空时仅判断是否为标识符
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && (name == "" || ident.Name == name)
+}
+
+// 与 isExportedOrBuiltinType 一致：具名类型需可导出或为内置类型，指针、切片等未命名类型均可
+func exportedOrBuiltin(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.IsExported() || types.Universe.Lookup(t.Name) != nil
+	case *ast.SelectorExpr:
+		return t.Sel.IsExported()
+	}
+	return true
+}
+
+// generate 生成 typeNames 指定的服务的代码，typeNames 为空时生成全部服务
+func (g *generator) generate(typeNames []string) ([]byte, error) {
+	var services []*serviceType
+	if len(typeNames) == 0 {
+		for _, svc := range g.services {
+			services = append(services, svc)
+		}
+		sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	} else {
+		for _, name := range typeNames {
+			svc, ok := g.services[name]
+			if !ok {
+				return nil, fmt.Errorf("type %s has no method satisfying the rpc signature", name)
+			}
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no service found in package %s", g.pkgName)
+	}
+
+	// 仅导入生成的服务引用到的包
+	imports := map[string]string{"context": "context"}
+	if g.pkgName != gbankrpcImportPath {
+		imports[gbankrpcImportPath] = gbankrpcImportPath
+	}
+	for _, svc := range services {
+		for _, m := range svc.Methods {
+			for _, name := range m.refs {
+				imports[name] = g.imports[name]
+			}
+		}
+	}
+
+	data := struct {
+		Package  string
+		Prefix   string
+		Imports  []string
+		Services []*serviceType
+	}{Package: g.pkgName, Services: services}
+	if g.pkgName != gbankrpcImportPath {
+		data.Prefix = gbankrpcImportPath + "."
+	}
+	for name, path := range imports {
+		spec := strconv.Quote(path)
+		if path[strings.LastIndex(path, "/")+1:] != name {
+			spec = name + " " + spec
+		}
+		data.Imports = append(data.Imports, spec)
+	}
+	sort.Strings(data.Imports)
+
+	var buf bytes.Buffer
+	if err := codeTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %s", err)
+	}
+	return src, nil
+}
+
+// 首字母小写，用于生成未导出的客户端实现类型名
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+var codeTemplate = template.Must(template.New("gbankrpc-gen").
+	Funcs(template.FuncMap{"lowerFirst": lowerFirst}).
+	Parse(`// Code generated by gbankrpc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range $svc := .Services}}
+{{- $client := printf "%sClient" (lowerFirst .Name)}}
+// {{.Name}}ServiceName {{.Name}} 注册到服务端时使用的名称
+const {{.Name}}ServiceName = "{{.Name}}"
+
+// {{.Name}}Server {{.Name}} 提供的服务方法，可用于替换实现或 mock
+type {{.Name}}Server interface {
+{{- range .Methods}}
+	{{.Name}}({{if .WithContext}}ctx context.Context, {{end}}args {{.ArgType}}, reply *{{.ReplyType}}) error
+{{- end}}
+}
+
+// Register{{.Name}}Server 以 {{.Name}}ServiceName 注册 srv
+func Register{{.Name}}Server(s *{{$.Prefix}}Server, srv {{.Name}}Server) error {
+	return s.RegisterName({{.Name}}ServiceName, srv)
+}
+
+// {{.Name}}Client {{.Name}} 的类型安全客户端，可用于 mock
+type {{.Name}}Client interface {
+{{- range .Methods}}
+	{{.Name}}(ctx context.Context, args {{.ArgType}}) ({{.ReplyType}}, error)
+{{- end}}
+}
+
+type {{$client}} struct {
+	c {{$.Prefix}}Caller
+}
+
+// New{{.Name}}Client 通过 c 调用 {{.Name}} 的方法，c 可以是 *Client 或 *xclient.XClient
+func New{{.Name}}Client(c {{$.Prefix}}Caller) {{.Name}}Client {
+	return &{{$client}}{c: c}
+}
+{{range .Methods}}
+func (c *{{$client}}) {{.Name}}(ctx context.Context, args {{.ArgType}}) ({{.ReplyType}}, error) {
+	return {{$.Prefix}}Invoke[{{.ArgType}}, {{.ReplyType}}](ctx, c.c, {{$svc.Name}}ServiceName+".{{.Name}}", args)
+}
+{{end}}
+{{- end}}`))
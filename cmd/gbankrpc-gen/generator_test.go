@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	g := newGenerator()
+	if err := g.parseDir(filepath.Join("testdata", "bank"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := g.generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "bank.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, golden) {
+		t.Errorf("generated code differs from testdata/bank.golden:\n%s", src)
+	}
+	if err := typeCheck(filepath.Join("testdata", "bank", "bank.go"), src); err != nil {
+		t.Errorf("generated code does not compile: %v", err)
+	}
+
+	if _, err := g.generate([]string{"Audit"}); err == nil {
+		t.Error("expect error for a type without rpc methods")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.ReadFile(filepath.Join("testdata", "bank", "bank.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bank.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复生成时跳过上一次生成的文件
+	for i := 0; i < 2; i++ {
+		if err := run(dir, "Account", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bank_gbankrpc.go")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 将生成的代码与源文件作为同一个包进行类型检查
+func typeCheck(source string, generated []byte) error {
+	fset := token.NewFileSet()
+	f1, err := parser.ParseFile(fset, source, nil, 0)
+	if err != nil {
+		return err
+	}
+	f2, err := parser.ParseFile(fset, "generated.go", generated, 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check(f1.Name.Name, fset, []*ast.File{f1, f2}, nil)
+	return err
+}
+
+func TestImportName(t *testing.T) {
+	if name := importName("GbankRPC/codec", "."); name != "codec" {
+		t.Errorf("importName(GbankRPC/codec) = %q", name)
+	}
+
+	tests := []struct {
+		path, name string
+	}{
+		{"time", "time"},
+		{"example.com/foo/v2", "foo"},
+		{"gopkg.in/yaml.v3", "yaml"},
+	}
+	for _, tt := range tests {
+		if name := guessImportName(tt.path); name != tt.name {
+			t.Errorf("guessImportName(%q) = %q, want %q", tt.path, name, tt.name)
+		}
+	}
+}
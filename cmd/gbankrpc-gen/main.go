@@ -0,0 +1,54 @@
+// gbankrpc-gen 解析 Go 包中满足 GbankRPC 注册规则的服务类型，生成类型安全的客户端、注册方法及接口定义。
+//
+// 用法：
+//
+//	gbankrpc-gen [-dir .] [-type Foo,Bar] [-output foo_gbankrpc.go]
+//
+// 可配合 go:generate 使用：
+//
+//	//go:generate gbankrpc-gen -type Foo
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package to parse")
+	typeNames := flag.String("type", "", "comma-separated list of service type names, default all")
+	output := flag.String("output", "", "output file name, default <package>_gbankrpc.go in dir")
+	flag.Parse()
+
+	if err := run(*dir, *typeNames, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "gbankrpc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, typeNames, output string) error {
+	g := newGenerator()
+	if err := g.parseDir(dir, output); err != nil {
+		return err
+	}
+
+	var names []string
+	if typeNames != "" {
+		names = strings.Split(typeNames, ",")
+	}
+	src, err := g.generate(names)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = strings.ToLower(g.pkgName) + generatedSuffix
+	}
+	if !filepath.IsAbs(output) && filepath.Dir(output) == "." {
+		output = filepath.Join(dir, output)
+	}
+	return os.WriteFile(output, src, 0644)
+}
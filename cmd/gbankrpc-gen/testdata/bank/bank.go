@@ -0,0 +1,51 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type TransferArgs struct {
+	From, To string
+	Amount   int
+}
+
+// Account 包含两种签名的服务方法
+type Account struct{}
+
+func (a *Account) Transfer(ctx context.Context, args TransferArgs, reply *int) error {
+	return nil
+}
+
+func (a Account) Balance(name string, reply *int) error {
+	return nil
+}
+
+func (a Account) History(since time.Time, reply *[]TransferArgs) error {
+	return nil
+}
+
+// 以下方法不满足注册规则
+func (a Account) NoReply(name string) error {
+	return nil
+}
+
+func (a Account) ValueReply(name string, reply int) error {
+	return nil
+}
+
+func (a Account) unexported(name string, reply *int) error {
+	return nil
+}
+
+func (a Account) Internal(args transferArgs, reply *int) error {
+	return errors.New("not registered")
+}
+
+type transferArgs struct{}
+
+// Audit 不包含可注册的方法
+type Audit struct{}
+
+func (a Audit) Log(msg string) {}
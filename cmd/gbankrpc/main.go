@@ -0,0 +1,190 @@
+// gbankrpc 命令行客户端，可查询服务端提供的服务并以 JSON 参数调用方法。
+//
+// 用法：
+//
+//	gbankrpc [flags] <address> list [Service]
+//	gbankrpc [flags] <address> describe Service.Method
+//	gbankrpc [flags] <address> call Service.Method '<json args>'
+//
+// address 可以是 XDial 支持的地址，如 tcp@127.0.0.1:9999、unix@/tmp/rpc.sock、http@127.0.0.1:8888，
+// 也可以是注册中心地址，如 http://127.0.0.1:9999/gbankrpc/registry，此时随机选择一个服务实例。
+// 调用使用 JSON 编解码，参数及返回值无需知道具体的 Go 类型。
+// list 与 describe 依赖反射服务，服务端需通过 WithReflection(true) 开启。
+package main
+
+import (
+	"GbankRPC"
+	"GbankRPC/codec"
+	"GbankRPC/xclient"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// metadataFlag 可重复设置的 key=value 元数据
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("metadata %q should be key=value", s)
+	}
+	m[k] = v
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "gbankrpc:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	md := make(metadataFlag)
+	fs := flag.NewFlagSet("gbankrpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	timeout := fs.Duration("timeout", 10*time.Second, "connect and call timeout")
+	fs.Var(md, "H", "request metadata as key=value, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gbankrpc [flags] <address> list [Service]")
+		fmt.Fprintln(stderr, "       gbankrpc [flags] <address> describe Service.Method")
+		fmt.Fprintln(stderr, "       gbankrpc [flags] <address> call Service.Method '<json args>'")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("address and command are required")
+	}
+
+	caller, closer, err := dial(fs.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if len(md) > 0 {
+		ctx = GbankRPC.WithMetadata(ctx, md)
+	}
+
+	rest := fs.Args()[2:]
+	switch cmd := fs.Arg(1); cmd {
+	case "list":
+		return list(ctx, caller, rest, stdout)
+	case "describe":
+		if len(rest) != 1 {
+			return errors.New("describe requires Service.Method")
+		}
+		var desc GbankRPC.MethodDescriptor
+		if err := caller.Call(ctx, GbankRPC.ReflectionServiceName+".DescribeMethod", rest[0], &desc); err != nil {
+			return err
+		}
+		return printJSON(stdout, desc)
+	case "call":
+		if len(rest) < 1 || len(rest) > 2 {
+			return errors.New("call requires Service.Method and optional json args")
+		}
+		argsJSON := "null"
+		if len(rest) == 2 {
+			argsJSON = rest[1]
+		}
+		if !json.Valid([]byte(argsJSON)) {
+			return fmt.Errorf("invalid json args: %s", argsJSON)
+		}
+		var reply json.RawMessage
+		if err := caller.Call(ctx, rest[0], json.RawMessage(argsJSON), &reply); err != nil {
+			return err
+		}
+		return printJSON(stdout, reply)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// 连接服务端，注册中心地址使用 XClient 随机选择服务实例
+func dial(address string, timeout time.Duration) (GbankRPC.Caller, io.Closer, error) {
+	opt := &GbankRPC.Option{
+		CodecType:      codec.JsonCodecType,
+		ConnectTimeout: timeout,
+	}
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		d := xclient.NewGBankRPCDiscovery(address, 0)
+		if err := d.Refresh(); err != nil {
+			return nil, nil, err
+		}
+		if len(d.GetAll()) == 0 {
+			return nil, nil, fmt.Errorf("no alive server in registry %s", address)
+		}
+		x := xclient.NewXClient(d, xclient.RandomSelect, opt)
+		return x, x, nil
+	}
+
+	if !strings.Contains(address, "@") {
+		return nil, nil, fmt.Errorf("address %q should be protocol@addr or a registry url", address)
+	}
+	client, err := GbankRPC.XDial(address, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, client, nil
+}
+
+// 列出全部服务，指定 service 时列出该服务的方法
+func list(ctx context.Context, caller GbankRPC.Caller, args []string, w io.Writer) error {
+	var reply GbankRPC.ListServicesReply
+	err := caller.Call(ctx, GbankRPC.ReflectionServiceName+".ListServices", GbankRPC.ListServicesArgs{}, &reply)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		for _, svc := range reply.Services {
+			fmt.Fprintln(w, svc.Name)
+		}
+		return nil
+	}
+	for _, svc := range reply.Services {
+		if svc.Name == args[0] {
+			for _, m := range svc.Methods {
+				fmt.Fprintln(w, svc.Name+"."+m)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("service %s not found", args[0])
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"GbankRPC"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Args struct{ Num1, Num2 int }
+
+type Calc int
+
+func (c Calc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (c Calc) Tenant(ctx context.Context, args int, reply *string) error {
+	*reply = GbankRPC.IncomingMetadata(ctx)["tenant"]
+	return nil
+}
+
+func startServer(t *testing.T) string {
+	s := GbankRPC.NewServer(GbankRPC.WithReflection(true))
+	if err := s.RegisterService(new(Calc)); err != nil {
+		t.Fatal(err)
+	}
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Accept(ls)
+	t.Cleanup(func() { s.Close() })
+	return "tcp@" + ls.Addr().String()
+}
+
+func TestRun(t *testing.T) {
+	addr := startServer(t)
+	tests := []struct {
+		name   string
+		args   []string
+		expect string
+	}{
+		{"list services", []string{addr, "list"}, "Calc\n_Health\n_Reflection\n"},
+		{"list methods", []string{addr, "list", "Calc"}, "Calc.Sum\nCalc.Tenant\n"},
+		{"call", []string{addr, "call", "Calc.Sum", `{"Num1": 1, "Num2": 2}`}, "3\n"},
+		{"metadata", []string{"-H", "tenant=bank-a", addr, "call", "Calc.Tenant", "1"}, "\"bank-a\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(tt.args, &stdout, &stderr); err != nil {
+				t.Fatal(err, stderr.String())
+			}
+			if stdout.String() != tt.expect {
+				t.Errorf("expect %q, got %q", tt.expect, stdout.String())
+			}
+		})
+	}
+
+	t.Run("describe", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{addr, "describe", "Calc.Sum"}, &stdout, &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stdout.String(), `"Name": "main.Args"`) {
+			t.Errorf("unexpected description %s", stdout.String())
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := run([]string{addr, "call", "Calc.Missing", "1"}, &stdout, &stderr)
+		if GbankRPC.ErrorCode(err) != GbankRPC.CodeNotFound {
+			t.Errorf("expect NotFound, got %v", err)
+		}
+		if err := run([]string{addr, "call", "Calc.Sum", "{"}, &stdout, &stderr); err == nil {
+			t.Error("expect invalid json error")
+		}
+		if err := run([]string{"127.0.0.1:1", "list"}, &stdout, &stderr); err == nil {
+			t.Error("expect invalid address error")
+		}
+	})
+}
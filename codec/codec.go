@@ -1,14 +1,40 @@
 package codec
 
-import "io"
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
 
 type Header struct {
 	ServiceMethod string
 	// 请求序号，区分不同请求
-	Seq           uint64
-	Err           string
+	Seq uint64
+	// 错误信息、错误码及错误详情，Err 与 ErrCode 均为空表示调用成功
+	Err        string
+	ErrCode    uint32
+	ErrDetails map[string]string
+	// 随请求/响应传递的元数据，如 trace id、鉴权信息等
+	Metadata map[string]string
+	// 客户端发送请求时剩余的超时时间，为 0 表示不限制
+	Timeout time.Duration
+	// 控制帧类型，普通请求/响应为 ControlNone
+	Control ControlType
 }
 
+// ControlType 控制帧类型，控制帧的 body 无实际意义
+type ControlType uint8
+
+const (
+	ControlNone ControlType = iota
+	// ControlCancel 客户端取消 Seq 对应的请求
+	ControlCancel
+	// ControlGoAway 服务端即将关闭，客户端不应再发送新请求，Seq 为服务端最后接收的请求序号
+	ControlGoAway
+)
+
 type Codec interface {
 	io.Closer
 	ReadHeader(*Header) error
@@ -25,9 +51,72 @@ const (
 	GobCodecType  Type = "application/gob"
 )
 
-var NewCodecFuncTable map[Type]NewCodecFunc
+var (
+	codecMu    sync.RWMutex
+	codecTable = make(map[Type]NewCodecFunc)
+)
+
+// NewCodecFuncTable 编解码类型到构造函数的映射，为兼容旧代码保留。
+// Register 注册的类型会同步写入该 map，Lookup 也会查找直接写入该 map 的类型。
+//
+// Deprecated: 直接读写该 map 不是并发安全的，请使用 Register 与 Lookup。
+var NewCodecFuncTable = make(map[Type]NewCodecFunc)
 
 func init() {
-	NewCodecFuncTable = make(map[Type]NewCodecFunc)
-	NewCodecFuncTable[GobCodecType] = NewGobCodec
+	Register(GobCodecType, NewGobCodec)
+	Register(JsonCodecType, NewJsonCodec)
+	Register(FramedCodecType, NewFramedCodec)
+}
+
+// Register 注册编解码类型，并发安全，同一类型不允许重复注册
+func Register(typ Type, f NewCodecFunc) error {
+	if typ == "" {
+		return errors.New("codec: register empty codec type")
+	}
+	if f == nil {
+		return errors.New("codec: register nil NewCodecFunc for " + string(typ))
+	}
+
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	if _, ok := codecTable[typ]; ok {
+		return errors.New("codec: codec type already registered: " + string(typ))
+	}
+	if _, ok := NewCodecFuncTable[typ]; ok {
+		return errors.New("codec: codec type already registered: " + string(typ))
+	}
+	codecTable[typ] = f
+	NewCodecFuncTable[typ] = f
+	return nil
+}
+
+// Lookup 查找编解码类型对应的构造函数
+func Lookup(typ Type) (NewCodecFunc, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+
+	if f, ok := codecTable[typ]; ok {
+		return f, true
+	}
+	f, ok := NewCodecFuncTable[typ]
+	return f, ok && f != nil
+}
+
+// Types 返回全部已注册的编解码类型
+func Types() []Type {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+
+	res := make([]Type, 0, len(codecTable))
+	for typ := range codecTable {
+		res = append(res, typ)
+	}
+	for typ, f := range NewCodecFuncTable {
+		if _, ok := codecTable[typ]; !ok && f != nil {
+			res = append(res, typ)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
 }
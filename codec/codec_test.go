@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"io"
+	"testing"
+)
+
+// 移除测试中注册的编解码类型，使测试可以重复运行
+func unregister(t *testing.T, typ Type) {
+	t.Cleanup(func() {
+		codecMu.Lock()
+		defer codecMu.Unlock()
+		delete(codecTable, typ)
+		delete(NewCodecFuncTable, typ)
+	})
+}
+
+func TestRegister(t *testing.T) {
+	f := func(conn io.ReadWriteCloser) Codec { return NewGobCodec(conn) }
+	if err := Register(GobCodecType, f); err == nil {
+		t.Fatal("duplicate register should fail")
+	}
+	if err := Register("", f); err == nil {
+		t.Fatal("register empty type should fail")
+	}
+	if err := Register("application/x-test", nil); err == nil {
+		t.Fatal("register nil func should fail")
+	}
+	unregister(t, "application/x-test")
+	if err := Register("application/x-test", f); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if _, ok := Lookup("application/x-test"); !ok {
+		t.Fatal("registered codec not found")
+	}
+	if _, ok := Lookup("application/x-unknown"); ok {
+		t.Fatal("unexpected codec found")
+	}
+}
+
+func TestNewCodecFuncTable(t *testing.T) {
+	// 旧代码直接写入 NewCodecFuncTable 注册的类型仍可查找
+	unregister(t, "application/x-legacy")
+	codecMu.Lock()
+	NewCodecFuncTable["application/x-legacy"] = NewJsonCodec
+	codecMu.Unlock()
+	if _, ok := Lookup("application/x-legacy"); !ok {
+		t.Fatal("legacy codec not found")
+	}
+	if NewCodecFuncTable[GobCodecType] == nil {
+		t.Fatal("expect built-in codecs in NewCodecFuncTable")
+	}
+	if err := Register("application/x-legacy", NewJsonCodec); err == nil {
+		t.Fatal("duplicate register should fail")
+	}
+}
@@ -0,0 +1,225 @@
+// Package codectest 提供编解码器的一致性测试，自定义编解码器可在自己的测试中调用 RunConformance。
+package codectest
+
+import (
+	"GbankRPC/codec"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// conformanceTimeout 单个读写操作的最长等待时间，防止实现有误时测试永久阻塞
+const conformanceTimeout = 5 * time.Second
+
+// ConformanceArgs 一致性测试中使用的结构体 body
+type ConformanceArgs struct {
+	Num1, Num2 int
+	Name       string
+	Tags       []string
+	Attrs      map[string]int
+}
+
+// RunConformance 校验 Codec 实现是否满足框架对编解码器的约定，
+// 自定义编解码器可在自己的测试中调用：codectest.RunConformance(t, NewMyCodec)
+func RunConformance(t *testing.T, f codec.NewCodecFunc) {
+	t.Run("round trip", func(t *testing.T) { conformanceRoundTrip(t, f) })
+	t.Run("nil body", func(t *testing.T) { conformanceNilBody(t, f) })
+	t.Run("write error", func(t *testing.T) { conformanceWriteError(t, f) })
+	t.Run("read error", func(t *testing.T) { conformanceReadError(t, f) })
+	t.Run("close", func(t *testing.T) { conformanceClose(t, f) })
+}
+
+// 建立一对通过内存管道相连的编解码器
+func conformancePair(f codec.NewCodecFunc) (codec.Codec, codec.Codec) {
+	c1, c2 := net.Pipe()
+	return f(c1), f(c2)
+}
+
+// 异步执行 fn，超时视为实现阻塞
+func conformanceAsync(fn func() error) <-chan error {
+	res := make(chan error, 1)
+	go func() {
+		res <- fn()
+	}()
+	return res
+}
+
+func conformanceWait(t *testing.T, name string, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(conformanceTimeout):
+		t.Fatalf("%s: blocked for more than %s", name, conformanceTimeout)
+		return nil
+	}
+}
+
+func conformanceRoundTrip(t *testing.T, f codec.NewCodecFunc) {
+	w, r := conformancePair(f)
+	defer w.Close()
+	defer r.Close()
+
+	type message struct {
+		h    codec.Header
+		body interface{}
+	}
+	messages := []message{
+		{h: codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, body: ConformanceArgs{Num1: 1, Num2: 2}},
+		{h: codec.Header{ServiceMethod: "Foo.Sum", Seq: 2, Err: "100% failed", ErrCode: 5, ErrDetails: map[string]string{"field": "Num1"}}, body: 42},
+		{h: codec.Header{ServiceMethod: "Foo.Echo", Seq: 3, Metadata: map[string]string{"trace-id": "abc"}}, body: "hello gbankrpc"},
+		{h: codec.Header{Seq: 5, Control: codec.ControlCancel}, body: struct{}{}},
+		{h: codec.Header{ServiceMethod: "Foo.Full", Seq: 4, Timeout: time.Second}, body: ConformanceArgs{
+			Num1: -1, Name: "full", Tags: []string{"a", "b"}, Attrs: map[string]int{"x": 1},
+		}},
+	}
+
+	sent := conformanceAsync(func() error {
+		for i := range messages {
+			if err := w.Write(&messages[i].h, messages[i].body); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	for _, m := range messages {
+		var h codec.Header
+		if err := conformanceWait(t, "ReadHeader", conformanceAsync(func() error {
+			return r.ReadHeader(&h)
+		})); err != nil {
+			t.Fatalf("ReadHeader error: %v", err)
+		}
+		if !reflect.DeepEqual(h, m.h) {
+			t.Fatalf("header mismatch: expect %+v, got %+v", m.h, h)
+		}
+
+		body := reflect.New(reflect.TypeOf(m.body))
+		if err := conformanceWait(t, "ReadBody", conformanceAsync(func() error {
+			return r.ReadBody(body.Interface())
+		})); err != nil {
+			t.Fatalf("ReadBody error: %v", err)
+		}
+		if !reflect.DeepEqual(body.Elem().Interface(), m.body) {
+			t.Fatalf("body mismatch: expect %+v, got %+v", m.body, body.Elem().Interface())
+		}
+	}
+
+	if err := conformanceWait(t, "Write", sent); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+}
+
+// 客户端收到无人等待的响应时会调用 ReadBody(nil) 丢弃 body，丢弃后不能影响后续消息的读取
+func conformanceNilBody(t *testing.T, f codec.NewCodecFunc) {
+	w, r := conformancePair(f)
+	defer w.Close()
+	defer r.Close()
+
+	sent := conformanceAsync(func() error {
+		if err := w.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, ConformanceArgs{Num1: 1, Tags: []string{"x"}}); err != nil {
+			return err
+		}
+		return w.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 2}, 7)
+	})
+
+	var h codec.Header
+	if err := conformanceWait(t, "ReadHeader", conformanceAsync(func() error {
+		return r.ReadHeader(&h)
+	})); err != nil || h.Seq != 1 {
+		t.Fatalf("ReadHeader: expect seq 1, got %d, err %v", h.Seq, err)
+	}
+	if err := conformanceWait(t, "ReadBody", conformanceAsync(func() error {
+		return r.ReadBody(nil)
+	})); err != nil {
+		t.Fatalf("ReadBody(nil) error: %v", err)
+	}
+
+	var body int
+	if err := conformanceWait(t, "ReadHeader", conformanceAsync(func() error {
+		if err := r.ReadHeader(&h); err != nil {
+			return err
+		}
+		return r.ReadBody(&body)
+	})); err != nil || h.Seq != 2 || body != 7 {
+		t.Fatalf("read after ReadBody(nil): expect seq 2 body 7, got %d %d, err %v", h.Seq, body, err)
+	}
+
+	if err := conformanceWait(t, "Write", sent); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+}
+
+func conformanceWriteError(t *testing.T, f codec.NewCodecFunc) {
+	t.Run("unsupported body", func(t *testing.T) {
+		w, r := conformancePair(f)
+		defer w.Close()
+		defer r.Close()
+
+		// 对端持续读取，避免写入被管道阻塞
+		go func() {
+			var h codec.Header
+			for r.ReadHeader(&h) == nil && r.ReadBody(nil) == nil {
+			}
+		}()
+
+		err := conformanceWait(t, "Write", conformanceAsync(func() error {
+			return w.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, make(chan int))
+		}))
+		if err == nil {
+			t.Fatal("Write of an unencodable body should return an error")
+		}
+	})
+	t.Run("peer closed", func(t *testing.T) {
+		w, r := conformancePair(f)
+		defer w.Close()
+		r.Close()
+
+		err := conformanceWait(t, "Write", conformanceAsync(func() error {
+			return w.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, 1)
+		}))
+		if err == nil {
+			t.Fatal("Write to a closed peer should return an error")
+		}
+	})
+}
+
+func conformanceReadError(t *testing.T, f codec.NewCodecFunc) {
+	w, r := conformancePair(f)
+	defer r.Close()
+	w.Close()
+
+	var h codec.Header
+	err := conformanceWait(t, "ReadHeader", conformanceAsync(func() error {
+		return r.ReadHeader(&h)
+	}))
+	if err == nil {
+		t.Fatal("ReadHeader from a closed peer should return an error")
+	}
+}
+
+func conformanceClose(t *testing.T, f codec.NewCodecFunc) {
+	w, r := conformancePair(f)
+	defer w.Close()
+
+	// Close 需要唤醒阻塞中的读取
+	var h codec.Header
+	reading := conformanceAsync(func() error {
+		return r.ReadHeader(&h)
+	})
+	time.Sleep(10 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	if err := conformanceWait(t, "ReadHeader", reading); err == nil {
+		t.Fatal("ReadHeader blocked before Close should return an error")
+	}
+
+	err := conformanceWait(t, "Write", conformanceAsync(func() error {
+		return r.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: 1}, 1)
+	}))
+	if err == nil {
+		t.Fatal("Write after Close should return an error")
+	}
+}
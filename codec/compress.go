@@ -0,0 +1,263 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Compression 消息压缩算法
+type Compression string
+
+const (
+	CompressionNone    Compression = ""
+	CompressionGzip    Compression = "gzip"
+	CompressionDeflate Compression = "deflate"
+	CompressionZlib    Compression = "zlib"
+)
+
+// DefaultCompressThreshold 默认压缩阈值，编码后小于该长度的消息不压缩
+const DefaultCompressThreshold = 1024
+
+const (
+	// 帧头：1 字节标记位 + 4 字节大端序的 payload 长度
+	compressFrameHeaderSize = 5
+	// 标记 payload 已压缩
+	compressFlagCompressed = 1 << 0
+)
+
+// CompressOption 压缩编解码器配置
+type CompressOption struct {
+	// 压缩阈值，编码后小于该长度的消息不压缩，小于等于 0 时使用 DefaultCompressThreshold
+	Threshold int
+	// 单条消息压缩前及压缩后的最大长度，读写超出时返回 ErrFrameTooLarge，为 0 时使用 DefaultMaxFrameSize
+	MaxMessageSize uint32
+}
+
+// 可复用的压缩器
+type resetWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+var compressWriterPools = map[Compression]*sync.Pool{
+	CompressionGzip: {New: func() interface{} { return gzip.NewWriter(nil) }},
+	CompressionDeflate: {New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}},
+	CompressionZlib: {New: func() interface{} { return zlib.NewWriter(nil) }},
+}
+
+// Compressions 返回支持的压缩算法
+func Compressions() []Compression {
+	res := make([]Compression, 0, len(compressWriterPools))
+	for c := range compressWriterPools {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// WithCompression 包装编解码器，编码后长度不小于 threshold 的消息压缩后发送，
+// threshold 小于等于 0 时使用 DefaultCompressThreshold
+func WithCompression(f NewCodecFunc, c Compression, threshold int) (NewCodecFunc, error) {
+	return WithCompressionOption(f, c, CompressOption{Threshold: threshold})
+}
+
+// WithCompressionOption 按 opt 包装编解码器，见 WithCompression
+func WithCompressionOption(f NewCodecFunc, c Compression, opt CompressOption) (NewCodecFunc, error) {
+	if c == CompressionNone {
+		return f, nil
+	}
+	if _, ok := compressWriterPools[c]; !ok {
+		return nil, fmt.Errorf("codec: unsupported compression %q", c)
+	}
+	if opt.Threshold <= 0 {
+		opt.Threshold = DefaultCompressThreshold
+	}
+	if opt.MaxMessageSize == 0 {
+		opt.MaxMessageSize = DefaultMaxFrameSize
+	}
+
+	return func(conn io.ReadWriteCloser) Codec {
+		cc := &compressCodec{
+			conn:        conn,
+			r:           bufio.NewReader(conn),
+			compression: c,
+			threshold:   opt.Threshold,
+			maxSize:     opt.MaxMessageSize,
+		}
+		// 内层编解码器读写的是解压后/压缩前的消息流
+		cc.inner = f(&compressStream{cc})
+		return cc
+	}, nil
+}
+
+// compressCodec 每条消息（header + body）由内层编解码器编码后单独成帧，按需压缩
+type compressCodec struct {
+	conn        io.ReadWriteCloser
+	r           *bufio.Reader
+	inner       Codec
+	compression Compression
+	threshold   int
+	maxSize     uint32
+	// 内层编解码器写入的单条消息
+	wbuf bytes.Buffer
+	// 当前帧中尚未被内层编解码器读取的数据
+	rbuf bytes.Reader
+}
+
+// Write 出错时关闭连接，内层编解码器（如 gob）可能已记录了未发出的类型信息，流无法继续使用
+func (c *compressCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		c.wbuf.Reset()
+		if err != nil {
+			c.conn.Close()
+		}
+	}()
+
+	if err = c.inner.Write(h, body); err != nil {
+		return err
+	}
+
+	var flag byte
+	payload := c.wbuf.Bytes()
+	// 对端解压后的长度同样受限，压缩前超限的消息无法被读取
+	if uint64(len(payload)) > uint64(c.maxSize) {
+		return fmt.Errorf("%w: %d bytes exceeds limit %d", ErrFrameTooLarge, len(payload), c.maxSize)
+	}
+	if len(payload) >= c.threshold {
+		var compressed []byte
+		if compressed, err = c.compress(payload); err != nil {
+			return err
+		}
+		// 压缩收益为负时直接发送原始数据
+		if len(compressed) < len(payload) {
+			flag |= compressFlagCompressed
+			payload = compressed
+		}
+	}
+
+	frame := make([]byte, compressFrameHeaderSize, compressFrameHeaderSize+len(payload))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	_, err = c.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (c *compressCodec) compress(payload []byte) ([]byte, error) {
+	pool := compressWriterPools[c.compression]
+	w := pool.Get().(resetWriter)
+	defer pool.Put(w)
+
+	var b bytes.Buffer
+	w.Reset(&b)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c *compressCodec) decompress(payload []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch c.compression {
+	case CompressionGzip:
+		r, err = gzip.NewReader(bytes.NewReader(payload))
+	case CompressionDeflate:
+		r = flate.NewReader(bytes.NewReader(payload))
+	case CompressionZlib:
+		r, err = zlib.NewReader(bytes.NewReader(payload))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// 限制解压后的长度，防止压缩炸弹
+	res, err := io.ReadAll(io.LimitReader(r, int64(c.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(res)) > uint64(c.maxSize) {
+		return nil, fmt.Errorf("%w: decompressed message exceeds %d bytes", ErrFrameTooLarge, c.maxSize)
+	}
+	return res, nil
+}
+
+// 读取下一帧并解压，结果供内层编解码器读取
+func (c *compressCodec) readFrame() error {
+	var prefix [compressFrameHeaderSize]byte
+	if _, err := io.ReadFull(c.r, prefix[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > c.maxSize {
+		return fmt.Errorf("%w: %d bytes exceeds limit %d", ErrFrameTooLarge, size, c.maxSize)
+	}
+	// 按实际到达的数据逐步扩容，不按对端声明的长度预先分配
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, c.r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	payload := b.Bytes()
+
+	if prefix[0]&compressFlagCompressed != 0 {
+		var err error
+		if payload, err = c.decompress(payload); err != nil {
+			return err
+		}
+	}
+	c.rbuf.Reset(payload)
+	return nil
+}
+
+func (c *compressCodec) ReadHeader(h *Header) error {
+	return c.inner.ReadHeader(h)
+}
+
+func (c *compressCodec) ReadBody(body interface{}) error {
+	return c.inner.ReadBody(body)
+}
+
+func (c *compressCodec) Close() error {
+	return c.conn.Close()
+}
+
+// compressStream 提供给内层编解码器的连接
+type compressStream struct {
+	c *compressCodec
+}
+
+func (s *compressStream) Read(p []byte) (int, error) {
+	// 当前帧读完后才读取下一帧，避免内层编解码器预读时阻塞在尚未到达的消息上
+	for s.c.rbuf.Len() == 0 {
+		if err := s.c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	return s.c.rbuf.Read(p)
+}
+
+func (s *compressStream) Write(p []byte) (int, error) {
+	return s.c.wbuf.Write(p)
+}
+
+func (s *compressStream) Close() error {
+	return s.c.conn.Close()
+}
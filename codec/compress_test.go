@@ -0,0 +1,102 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressCodec_Threshold(t *testing.T) {
+	f, err := WithCompression(NewJsonCodec, CompressionGzip, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := bufferConn{new(bytes.Buffer)}
+	cc := f(conn)
+	if err := cc.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if flag := conn.Bytes()[0]; flag&compressFlagCompressed != 0 {
+		t.Fatal("message below threshold should not be compressed")
+	}
+
+	conn.Reset()
+	large := strings.Repeat("gbankrpc", DefaultCompressThreshold)
+	if err := cc.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 2}, large); err != nil {
+		t.Fatal(err)
+	}
+	if flag := conn.Bytes()[0]; flag&compressFlagCompressed == 0 {
+		t.Fatal("message above threshold should be compressed")
+	}
+	if conn.Len() >= len(large) {
+		t.Fatalf("compressed frame of %d bytes is not smaller than payload", conn.Len())
+	}
+
+	var h Header
+	var body string
+	if err := cc.ReadHeader(&h); err != nil || cc.ReadBody(&body) != nil || body != large {
+		t.Fatalf("failed to read compressed message: %v", err)
+	}
+}
+
+func TestWithCompression_Unsupported(t *testing.T) {
+	if _, err := WithCompression(NewGobCodec, "br", 0); err == nil {
+		t.Fatal("unsupported compression should fail")
+	}
+}
+
+func TestCompressCodec_MaxMessageSize(t *testing.T) {
+	newCodec := func(conn io.ReadWriteCloser, max uint32) Codec {
+		f, err := WithCompressionOption(NewGobCodec, CompressionGzip, CompressOption{Threshold: 1, MaxMessageSize: max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f(conn)
+	}
+	frame := func(flag byte, size uint32, payload []byte) []byte {
+		b := make([]byte, compressFrameHeaderSize, compressFrameHeaderSize+len(payload))
+		b[0] = flag
+		binary.BigEndian.PutUint32(b[1:], size)
+		return append(b, payload...)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		conn := bufferConn{bytes.NewBuffer(frame(0, DefaultMaxFrameSize+1, nil))}
+		var h Header
+		if err := newCodec(conn, 0).ReadHeader(&h); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expect ErrFrameTooLarge, got %v", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		// 声明的长度在限制内但数据不足时返回错误，不会按声明长度分配内存
+		conn := bufferConn{bytes.NewBuffer(frame(0, DefaultMaxFrameSize, []byte("short")))}
+		var h Header
+		if err := newCodec(conn, 0).ReadHeader(&h); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+		}
+	})
+	t.Run("decompressed", func(t *testing.T) {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(make([]byte, 1<<20))
+		w.Close()
+		conn := bufferConn{bytes.NewBuffer(frame(compressFlagCompressed, uint32(compressed.Len()), compressed.Bytes()))}
+		var h Header
+		if err := newCodec(conn, 1<<16).ReadHeader(&h); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expect ErrFrameTooLarge, got %v", err)
+		}
+	})
+	t.Run("write", func(t *testing.T) {
+		conn := bufferConn{new(bytes.Buffer)}
+		cc := newCodec(conn, 4096)
+		err := cc.Write(&Header{ServiceMethod: "Foo.Echo", Seq: 1}, strings.Repeat("x", 8192))
+		if !errors.Is(err, ErrFrameTooLarge) || conn.Len() != 0 {
+			t.Fatalf("expect ErrFrameTooLarge without writing, got %v, %d bytes", err, conn.Len())
+		}
+	})
+}
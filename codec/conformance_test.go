@@ -0,0 +1,40 @@
+package codec_test
+
+import (
+	"GbankRPC/codec"
+	"GbankRPC/codec/codectest"
+	"testing"
+)
+
+func TestGobCodec_Conformance(t *testing.T) {
+	codectest.RunConformance(t, codec.NewGobCodec)
+}
+
+func TestJsonCodec_Conformance(t *testing.T) {
+	codectest.RunConformance(t, codec.NewJsonCodec)
+}
+
+func TestCompressCodec_Conformance(t *testing.T) {
+	for _, c := range []codec.Compression{codec.CompressionGzip, codec.CompressionDeflate, codec.CompressionZlib} {
+		t.Run(string(c), func(t *testing.T) {
+			// 阈值为 1 时每条消息都会尝试压缩
+			f, err := codec.WithCompression(codec.NewGobCodec, c, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codectest.RunConformance(t, f)
+
+			f, _ = codec.WithCompression(codec.NewJsonCodec, c, 0)
+			codectest.RunConformance(t, f)
+		})
+	}
+}
+
+func TestFramedCodec_Conformance(t *testing.T) {
+	t.Run("crc", func(t *testing.T) {
+		codectest.RunConformance(t, codec.NewFramedCodec)
+	})
+	t.Run("no crc", func(t *testing.T) {
+		codectest.RunConformance(t, codec.NewFramedCodecFunc(codec.FramedOption{}))
+	})
+}
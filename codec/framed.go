@@ -0,0 +1,189 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const FramedCodecType Type = "application/x-gbankrpc-framed"
+
+// DefaultMaxFrameSize 默认单帧最大长度
+const DefaultMaxFrameSize = 16 << 20
+
+const (
+	// 帧头：1 字节标记位 + 4 字节大端序的 payload 长度
+	frameHeaderSize = 5
+	// 标记 payload 后附带 4 字节 CRC32 校验和
+	frameFlagCRC = 1 << 0
+)
+
+var (
+	ErrFrameTooLarge = errors.New("codec: frame too large")
+	ErrFrameChecksum = errors.New("codec: frame checksum mismatch")
+)
+
+// FramedOption 分帧编解码器配置
+type FramedOption struct {
+	// 单帧最大长度，读写超出时返回 ErrFrameTooLarge，为 0 时使用 DefaultMaxFrameSize
+	MaxFrameSize uint32
+	// 写入时是否附带 CRC32 校验和，读取时根据帧标记位决定是否校验
+	CRC bool
+}
+
+// FramedCodec 每个 header 与 body 单独成帧并带长度前缀，
+// 帧内使用独立的 gob 编码，单条消息出错不会影响连接上的编解码状态
+type FramedCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	buf  *bufio.Writer
+	opt  FramedOption
+	// 读取出现无法恢复的错误后，流已错位，后续读取直接返回该错误
+	readErr error
+}
+
+// NewFramedCodec 使用默认配置新建分帧编解码器
+func NewFramedCodec(conn io.ReadWriteCloser) Codec {
+	return newFramedCodec(conn, FramedOption{CRC: true})
+}
+
+// NewFramedCodecFunc 根据配置返回分帧编解码器的构造函数，可通过 Register 注册为自定义类型
+func NewFramedCodecFunc(opt FramedOption) NewCodecFunc {
+	return func(conn io.ReadWriteCloser) Codec {
+		return newFramedCodec(conn, opt)
+	}
+}
+
+func newFramedCodec(conn io.ReadWriteCloser, opt FramedOption) *FramedCodec {
+	if opt.MaxFrameSize == 0 {
+		opt.MaxFrameSize = DefaultMaxFrameSize
+	}
+	return &FramedCodec{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		buf:  bufio.NewWriter(conn),
+		opt:  opt,
+	}
+}
+
+// Write 先完成 header 与 body 的编码再写入连接，编码失败（包括超出 MaxFrameSize）时
+// 不写入任何数据并直接返回错误，连接可继续使用；写入连接失败时关闭连接
+func (f *FramedCodec) Write(h *Header, body interface{}) (err error) {
+	header, err := f.encode(h)
+	if err != nil {
+		return err
+	}
+	payload, err := f.encode(body)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if flushErr := f.buf.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			f.conn.Close()
+		}
+	}()
+	if err = f.writeFrame(header); err != nil {
+		return err
+	}
+	return f.writeFrame(payload)
+}
+
+func (f *FramedCodec) encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	if uint32(b.Len()) > f.opt.MaxFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit %d", ErrFrameTooLarge, b.Len(), f.opt.MaxFrameSize)
+	}
+	return b.Bytes(), nil
+}
+
+func (f *FramedCodec) writeFrame(payload []byte) error {
+	var prefix [frameHeaderSize]byte
+	if f.opt.CRC {
+		prefix[0] |= frameFlagCRC
+	}
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(payload)))
+
+	if _, err := f.buf.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := f.buf.Write(payload); err != nil {
+		return err
+	}
+	if f.opt.CRC {
+		var sum [4]byte
+		binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+		if _, err := f.buf.Write(sum[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FramedCodec) ReadHeader(h *Header) error {
+	payload, err := f.readFrame()
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(h)
+}
+
+func (f *FramedCodec) ReadBody(body interface{}) error {
+	payload, err := f.readFrame()
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(body)
+}
+
+// 读取一帧数据，长度超限时不分配内存直接返回错误
+func (f *FramedCodec) readFrame() ([]byte, error) {
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+
+	var prefix [frameHeaderSize]byte
+	if _, err := io.ReadFull(f.r, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > f.opt.MaxFrameSize {
+		f.readErr = fmt.Errorf("%w: %d bytes exceeds limit %d", ErrFrameTooLarge, size, f.opt.MaxFrameSize)
+		return nil, f.readErr
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(f.r, payload); err != nil {
+		return nil, err
+	}
+
+	if prefix[0]&frameFlagCRC != 0 {
+		var sum [4]byte
+		if _, err := io.ReadFull(f.r, sum[:]); err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(payload) {
+			return nil, ErrFrameChecksum
+		}
+	}
+	return payload, nil
+}
+
+func (f *FramedCodec) Close() error {
+	return f.conn.Close()
+}
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// 内存中的连接，便于构造任意字节流
+type bufferConn struct {
+	*bytes.Buffer
+}
+
+func (b bufferConn) Close() error { return nil }
+
+func TestFramedCodec_MaxFrameSize(t *testing.T) {
+	t.Run("read", func(t *testing.T) {
+		conn := bufferConn{new(bytes.Buffer)}
+		w := newFramedCodec(conn, FramedOption{})
+		header, _ := w.encode(&Header{ServiceMethod: "Foo.Sum", Seq: 1})
+		w.writeFrame(header)
+		w.buf.Flush()
+		// 伪造一个声明 2GB 长度的 body 帧
+		var prefix [frameHeaderSize]byte
+		binary.BigEndian.PutUint32(prefix[1:], 2<<30-1)
+		conn.Write(prefix[:])
+
+		r := NewFramedCodecFunc(FramedOption{MaxFrameSize: 1 << 20})(conn)
+		var h Header
+		if err := r.ReadHeader(&h); err != nil || h.Seq != 1 {
+			t.Fatalf("ReadHeader: seq %d, err %v", h.Seq, err)
+		}
+		var body int
+		if err := r.ReadBody(&body); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expect ErrFrameTooLarge, got %v", err)
+		}
+		// 流已错位，后续读取都应失败
+		if err := r.ReadHeader(&h); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expect sticky ErrFrameTooLarge, got %v", err)
+		}
+	})
+	t.Run("write", func(t *testing.T) {
+		c1, c2 := net.Pipe()
+		defer c2.Close()
+		go io.Copy(io.Discard, c2)
+
+		w := NewFramedCodecFunc(FramedOption{MaxFrameSize: 512})(c1)
+		err := w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, bytes.Repeat([]byte("x"), 4096))
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("expect ErrFrameTooLarge, got %v", err)
+		}
+		// 超限的消息未写出任何数据，连接仍可继续使用
+		if err := w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 2}, 1); err != nil {
+			t.Fatalf("expect connection still usable, got %v", err)
+		}
+	})
+}
+
+func TestFramedCodec_Checksum(t *testing.T) {
+	conn := bufferConn{new(bytes.Buffer)}
+	w := NewFramedCodec(conn)
+	if err := w.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, "payload"); err != nil {
+		t.Fatal(err)
+	}
+	// 篡改 header 帧 payload 的最后一个字节
+	data := conn.Bytes()
+	size := binary.BigEndian.Uint32(data[1:frameHeaderSize])
+	data[frameHeaderSize+int(size)-1] ^= 0xff
+
+	var h Header
+	if err := NewFramedCodec(conn).ReadHeader(&h); !errors.Is(err, ErrFrameChecksum) {
+		t.Fatalf("expect ErrFrameChecksum, got %v", err)
+	}
+}
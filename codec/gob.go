@@ -25,11 +25,12 @@ func NewGobCodec(conn io.ReadWriteCloser) Codec {
 	}
 }
 
-func (g *GobCodec) Write(h *Header, body interface{}) error {
-	var err error
+func (g *GobCodec) Write(h *Header, body interface{}) (err error) {
 	defer func() {
 		// 将缓冲区中的数据统一写入连接
-		g.buf.Flush()
+		if flushErr := g.buf.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
 		if err != nil {
 			g.conn.Close()
 		}
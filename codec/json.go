@@ -0,0 +1,63 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+type JsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(buf),
+	}
+}
+
+func (j *JsonCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		if flushErr := j.buf.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			j.conn.Close()
+		}
+	}()
+
+	// header 与 body 依次编码为两个 json 值，每个值以换行结尾，便于其他语言按行解析
+	if err = j.enc.Encode(h); err != nil {
+		return err
+	}
+
+	if err = j.enc.Encode(body); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (j *JsonCodec) ReadHeader(h *Header) error {
+	return j.dec.Decode(h)
+}
+
+func (j *JsonCodec) ReadBody(body interface{}) error {
+	// body 为 nil 时仍需消费掉流中的 body，避免影响下一个 header 的读取
+	if body == nil {
+		var discard json.RawMessage
+		return j.dec.Decode(&discard)
+	}
+	return j.dec.Decode(body)
+}
+
+func (j *JsonCodec) Close() error {
+	return j.conn.Close()
+}
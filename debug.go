@@ -1,24 +1,38 @@
 package GbankRPC
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
+const debugNav = `<p>
+	<a href="{{.Base}}">services</a> |
+	<a href="{{.Base}}/conns">connections</a> |
+	<a href="{{.Base}}/requests">in-flight requests</a> |
+	<a href="{{.Base}}/errors">recent errors</a> |
+	<a href="?format=json">json</a>
+	</p>`
+
 const debugText = `<html>
 	<body>
 	<title>GBankRPC Services</title>
-	{{range .}}
+	` + debugNav + `
+	{{range .Data}}
 	<hr>
 	Service {{.Name}}
 	<hr>
 		<table>
-		<th align=center>Method</th><th align=center>Calls</th>
-		{{range $Name, $mtype := .Method}}
+		<th align=center>Method</th><th align=center>Calls</th><th align=center>Panics</th>
+		{{range .Methods}}
 			<tr>
-			<td align=left font=fixed>{{$Name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
-			<td align=center>{{$mtype.CallNums}}</td>
+			<td align=left font=fixed>{{.Name}}({{.ArgType}}, {{.ReplyType}}) error</td>
+			<td align=center>{{.Calls}}</td>
+			<td align=center>{{.Panics}}</td>
 			</tr>
 		{{end}}
 		</table>
@@ -26,28 +40,254 @@ const debugText = `<html>
 	</body>
 	</html>`
 
-var debug = template.Must(template.New("RPC debug").Parse(debugText))
+const debugConnsText = `<html>
+	<body>
+	<title>GBankRPC Connections</title>
+	` + debugNav + `
+	<table>
+	<th align=center>Remote</th><th align=center>Codec</th><th align=center>Compression</th>
+	<th align=center>Age</th><th align=center>Pending</th>
+	{{range .Data}}
+		<tr>
+		<td align=left>{{.RemoteAddr}}</td>
+		<td align=left>{{.Codec}}</td>
+		<td align=left>{{.Compression}}</td>
+		<td align=right>{{printf "%.3fs" .AgeSeconds}}</td>
+		<td align=right>{{.Pending}}</td>
+		</tr>
+	{{end}}
+	</table>
+	</body>
+	</html>`
+
+const debugRequestsText = `<html>
+	<body>
+	<title>GBankRPC In-flight Requests</title>
+	` + debugNav + `
+	<table>
+	<th align=center>Remote</th><th align=center>Seq</th><th align=center>Method</th><th align=center>Elapsed</th>
+	{{range .Data}}
+		<tr>
+		<td align=left>{{.RemoteAddr}}</td>
+		<td align=right>{{.Seq}}</td>
+		<td align=left>{{.ServiceMethod}}</td>
+		<td align=right>{{printf "%.3fs" .ElapsedSeconds}}</td>
+		</tr>
+	{{end}}
+	</table>
+	</body>
+	</html>`
 
+const debugErrorsText = `<html>
+	<body>
+	<title>GBankRPC Recent Errors</title>
+	` + debugNav + `
+	{{range .Data}}
+	<hr>
+	Method {{.ServiceMethod}}
+	<hr>
+		<table>
+		<th align=center>Time</th><th align=center>Code</th><th align=center>Message</th>
+		{{range .Errors}}
+			<tr>
+			<td align=left>{{.Time.Format "2006-01-02 15:04:05.000"}}</td>
+			<td align=left>{{.Code}}</td>
+			<td align=left>{{.Message}}</td>
+			</tr>
+		{{end}}
+		</table>
+	{{end}}
+	</body>
+	</html>`
+
+var (
+	debug         = template.Must(template.New("RPC debug").Parse(debugText))
+	debugConns    = template.Must(template.New("RPC debug conns").Parse(debugConnsText))
+	debugRequests = template.Must(template.New("RPC debug requests").Parse(debugRequestsText))
+	debugErrors   = template.Must(template.New("RPC debug errors").Parse(debugErrorsText))
+)
+
+// debugServer 提供 debug 页面，路径为 debugPath 及其下的 /conns、/requests、/errors，
+// 请求携带 ?format=json 或 Accept 为 application/json 时返回 json
 type debugServer struct {
-	*server
+	*Server
 }
+
 type debugService struct {
-	Name   string
-	Method map[string]*MethodType
+	Name    string
+	Methods []debugMethod
+}
+
+type debugMethod struct {
+	Name      string
+	ArgType   string
+	ReplyType string
+	Calls     uint64
+	Panics    uint64
+}
+
+type debugConn struct {
+	RemoteAddr  string
+	Codec       string
+	Compression string
+	Established time.Time
+	AgeSeconds  float64
+	// 处理中的请求数
+	Pending int
+}
+
+type debugRequest struct {
+	RemoteAddr     string
+	Seq            uint64
+	ServiceMethod  string
+	Start          time.Time
+	ElapsedSeconds float64
+}
+
+type debugMethodErrors struct {
+	ServiceMethod string
+	Errors        []debugError
+}
+
+type debugError struct {
+	Time    time.Time
+	Code    string
+	Message string
 }
 
 func (d *debugServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var services []debugService
+	var data interface{}
+	var tmpl *template.Template
+	switch strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, d.debugPath), "/") {
+	case "":
+		data, tmpl = d.servicesPage(), debug
+	case "/conns":
+		data, tmpl = d.connsPage(), debugConns
+	case "/requests":
+		data, tmpl = d.requestsPage(), debugRequests
+	case "/errors":
+		data, tmpl = d.errorsPage(), debugErrors
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	if wantJSON(req) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			fmt.Fprintln(w, "rpc: error encoding json:", err.Error())
+		}
+		return
+	}
+
+	page := struct {
+		Base string
+		Data interface{}
+	}{Base: strings.TrimSuffix(d.debugPath, "/"), Data: data}
+	if err := tmpl.Execute(w, page); err != nil {
+		fmt.Fprintln(w, "rpc: error executing template:", err.Error())
+	}
+}
+
+// 请求携带 ?format=json 或 Accept 包含 application/json 时返回 json
+func wantJSON(req *http.Request) bool {
+	if format := req.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// 全部服务及方法，按名称排序
+func (d *debugServer) servicesPage() []debugService {
+	services := make([]debugService, 0)
 	d.serviceTable.Range(func(key, val interface{}) bool {
 		service := val.(*Service)
-		services = append(services, debugService{
-			Name:   key.(string),
-			Method: service.methods,
-		})
+		svc := debugService{Name: key.(string)}
+		for name, m := range service.methods {
+			svc.Methods = append(svc.Methods, debugMethod{
+				Name:      name,
+				ArgType:   m.ArgType.String(),
+				ReplyType: m.ReplyType.String(),
+				Calls:     m.GetCallNums(),
+				Panics:    m.GetPanicNums(),
+			})
+		}
+		sort.Slice(svc.Methods, func(i, j int) bool { return svc.Methods[i].Name < svc.Methods[j].Name })
+		services = append(services, svc)
 		return true
 	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
 
-	if err := debug.Execute(w, services); err != nil {
-		fmt.Fprintln(w, "rpc: error executing template:", err.Error())
+func (d *debugServer) serverConns() []*serverConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conns := make([]*serverConn, 0, len(d.conns))
+	for sc := range d.conns {
+		conns = append(conns, sc)
+	}
+	return conns
+}
+
+// 打开的连接，按建立时间排序
+func (d *debugServer) connsPage() []debugConn {
+	now := time.Now()
+	res := make([]debugConn, 0)
+	for _, sc := range d.serverConns() {
+		sc.mu.Lock()
+		res = append(res, debugConn{
+			RemoteAddr:  sc.remoteAddr,
+			Codec:       string(sc.codecType),
+			Compression: string(sc.compression),
+			Established: sc.start,
+			AgeSeconds:  now.Sub(sc.start).Seconds(),
+			Pending:     len(sc.inflight),
+		})
+		sc.mu.Unlock()
 	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Established.Before(res[j].Established) })
+	return res
+}
+
+// 处理中的请求，按开始时间排序
+func (d *debugServer) requestsPage() []debugRequest {
+	now := time.Now()
+	res := make([]debugRequest, 0)
+	for _, sc := range d.serverConns() {
+		sc.mu.Lock()
+		for seq, r := range sc.inflight {
+			res = append(res, debugRequest{
+				RemoteAddr:     sc.remoteAddr,
+				Seq:            seq,
+				ServiceMethod:  r.serviceMethod,
+				Start:          r.start,
+				ElapsedSeconds: now.Sub(r.start).Seconds(),
+			})
+		}
+		sc.mu.Unlock()
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start.Before(res[j].Start) })
+	return res
+}
+
+// 各方法最近的错误，仅包含有错误的方法
+func (d *debugServer) errorsPage() []debugMethodErrors {
+	res := make([]debugMethodErrors, 0)
+	d.serviceTable.Range(func(key, val interface{}) bool {
+		for name, m := range val.(*Service).methods {
+			recent := m.RecentErrors()
+			if len(recent) == 0 {
+				continue
+			}
+			me := debugMethodErrors{ServiceMethod: key.(string) + "." + name}
+			for _, e := range recent {
+				me.Errors = append(me.Errors, debugError{Time: e.Time, Code: e.Code.String(), Message: e.Message})
+			}
+			res = append(res, me)
+		}
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].ServiceMethod < res[j].ServiceMethod })
+	return res
 }
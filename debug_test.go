@@ -0,0 +1,99 @@
+package GbankRPC
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugServer(t *testing.T) {
+	s := NewServer()
+	t.Cleanup(func() { s.Close() })
+	w := &Waiter{done: make(chan error, 1)}
+	_assert(s.RegisterService(w) == nil, "failed to register Waiter")
+	_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	_ = client.Call(context.Background(), "Account.Withdraw", 1000, &reply)
+	// 连接关闭时取消
+	client.Go("Waiter.Wait", 1, new(int), nil)
+
+	d := &debugServer{s}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(d.requestsPage()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	get := func(path string, v interface{}) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if v != nil {
+			req.Header.Set("Accept", "application/json")
+		}
+		d.ServeHTTP(rec, req)
+		_assert(rec.Code == 200, "%s: unexpected status %d", path, rec.Code)
+		if v != nil {
+			_assert(json.Unmarshal(rec.Body.Bytes(), v) == nil, "%s: invalid json %s", path, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	t.Run("services", func(t *testing.T) {
+		html := get(defaultDebugRPCPath, nil)
+		_assert(strings.Contains(html, "Withdraw(int, *int) error"), "unexpected page %s", html)
+
+		var services []debugService
+		get(defaultDebugRPCPath+"?format=json", &services)
+		var account *debugService
+		for i := range services {
+			if services[i].Name == "Account" {
+				account = &services[i]
+			}
+		}
+		_assert(account != nil, "expect Account in services %+v", services)
+		_assert(account.Methods[1].Name == "Withdraw" && account.Methods[1].Calls == 1,
+			"unexpected methods %+v", account.Methods)
+	})
+	t.Run("no services", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", defaultDebugRPCPath+"?format=json", nil)
+		(&debugServer{NewServer(WithHealth(false))}).ServeHTTP(rec, req)
+		_assert(strings.TrimSpace(rec.Body.String()) == "[]", "expect empty list, got %s", rec.Body.String())
+	})
+	t.Run("conns", func(t *testing.T) {
+		var conns []debugConn
+		get(defaultDebugRPCPath+"/conns", &conns)
+		_assert(len(conns) == 1 && conns[0].Codec == string(DefaultOption.CodecType) && conns[0].Pending == 1,
+			"unexpected conns %+v", conns)
+		_assert(conns[0].RemoteAddr != "", "expect remote addr")
+	})
+	t.Run("requests", func(t *testing.T) {
+		var requests []debugRequest
+		get(defaultDebugRPCPath+"/requests", &requests)
+		_assert(len(requests) == 1 && requests[0].ServiceMethod == "Waiter.Wait" && requests[0].ElapsedSeconds > 0,
+			"unexpected requests %+v", requests)
+		html := get(defaultDebugRPCPath+"/requests", nil)
+		_assert(strings.Contains(html, "Waiter.Wait"), "unexpected page %s", html)
+	})
+	t.Run("errors", func(t *testing.T) {
+		var errs []debugMethodErrors
+		get(defaultDebugRPCPath+"/errors", &errs)
+		_assert(len(errs) == 1 && errs[0].ServiceMethod == "Account.Withdraw", "unexpected errors %+v", errs)
+		_assert(errs[0].Errors[0].Code == "Application(1001)" && strings.Contains(errs[0].Errors[0].Message, "balance"),
+			"unexpected error %+v", errs[0].Errors[0])
+	})
+	t.Run("not found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, httptest.NewRequest("GET", defaultDebugRPCPath+"/missing", nil))
+		_assert(rec.Code == 404, "expect 404, got %d", rec.Code)
+	})
+}
@@ -0,0 +1,143 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Code RPC 错误码
+type Code uint32
+
+const (
+	CodeOK Code = iota
+	// CodeUnknown 未携带错误码的错误，业务方法返回的普通 error 均为该错误码
+	CodeUnknown
+	// CodeCanceled 调用方取消了请求
+	CodeCanceled
+	// CodeInvalidArgument 请求格式错误或参数无法解码
+	CodeInvalidArgument
+	// CodeDeadlineExceeded 请求处理超时
+	CodeDeadlineExceeded
+	// CodeNotFound 服务或方法不存在
+	CodeNotFound
+	// CodeUnavailable 服务当前不可用，如连接已关闭
+	CodeUnavailable
+	// CodeInternal 框架内部错误
+	CodeInternal
+	// CodeResourceExhausted 超出服务端限制，如并发请求数已达上限
+	CodeResourceExhausted
+)
+
+// CodeApplication 起的错误码留给业务自定义
+const CodeApplication Code = 1000
+
+var codeNames = map[Code]string{
+	CodeOK:                "OK",
+	CodeUnknown:           "Unknown",
+	CodeCanceled:          "Canceled",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeNotFound:          "NotFound",
+	CodeUnavailable:       "Unavailable",
+	CodeInternal:          "Internal",
+	CodeResourceExhausted: "ResourceExhausted",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	if c >= CodeApplication {
+		return "Application(" + strconv.FormatUint(uint64(c), 10) + ")"
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// Error 携带错误码的 RPC 错误，会随响应头传回客户端，客户端可通过 errors.As 取出
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]string
+}
+
+// NewError 新建 RPC 错误
+func NewError(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+// Errorf 按格式新建 RPC 错误
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// WithDetail 附加错误详情，返回新的错误
+func (e *Error) WithDetail(key, value string) *Error {
+	res := &Error{Code: e.Code, Message: e.Message, Details: make(map[string]string, len(e.Details)+1)}
+	for k, v := range e.Details {
+		res.Details[k] = v
+	}
+	res.Details[key] = value
+	return res
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// Is 错误码相同且 target 未指定 Message 或 Message 相同时视为同一错误，
+// 便于使用 errors.Is(err, &Error{Code: CodeNotFound}) 判断错误类型
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code && (t.Message == "" || e.Message == t.Message)
+}
+
+// ErrorCode 获取 err 的错误码
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	}
+	return CodeUnknown
+}
+
+// 将 err 转为 RPC 错误
+func toRPCError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: ErrorCode(err), Message: err.Error()}
+}
+
+// 将错误写入响应头
+func setHeaderError(h *codec.Header, err error) {
+	e := toRPCError(err)
+	h.Err = e.Message
+	h.ErrCode = uint32(e.Code)
+	h.ErrDetails = e.Details
+}
+
+// 从响应头中解析错误
+func headerError(h *codec.Header) *Error {
+	code := Code(h.ErrCode)
+	// 旧版本服务端不携带错误码
+	if code == CodeOK {
+		code = CodeUnknown
+	}
+	return &Error{Code: code, Message: h.Err, Details: h.ErrDetails}
+}
@@ -0,0 +1,90 @@
+package GbankRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type Account int
+
+const codeInsufficientFunds = CodeApplication + 1
+
+func (a Account) Withdraw(amount int, reply *int) error {
+	if amount > 100 {
+		return NewError(codeInsufficientFunds, "balance below 100%").WithDetail("balance", "100")
+	}
+	if amount < 0 {
+		return errors.New("negative amount")
+	}
+	*reply = 100 - amount
+	return nil
+}
+
+func (a Account) Slow(ms int, reply *int) error {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return nil
+}
+
+func TestError(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), &Option{HandleTimeout: 100 * time.Millisecond})
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	call := func(serviceMethod string, args int) *Error {
+		err := client.Call(context.Background(), serviceMethod, args, &reply)
+		var e *Error
+		_assert(errors.As(err, &e), "expect *Error, got %v", err)
+		return e
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		e := call("Account.Deposit", 1)
+		_assert(e.Code == CodeNotFound, "expect NotFound, got %s", e.Code)
+		e = call("Ledger.Withdraw", 1)
+		_assert(e.Code == CodeNotFound, "expect NotFound, got %s", e.Code)
+		e = call("Account", 1)
+		_assert(e.Code == CodeInvalidArgument, "expect InvalidArgument, got %s", e.Code)
+
+		// 连接仍然可用
+		err := client.Call(context.Background(), "Account.Withdraw", 30, &reply)
+		_assert(err == nil && reply == 70, "expect 70, got %d, err %v", reply, err)
+	})
+	t.Run("application", func(t *testing.T) {
+		e := call("Account.Withdraw", 200)
+		_assert(e.Code == codeInsufficientFunds, "expect application code, got %s", e.Code)
+		_assert(e.Message == "balance below 100%", "message mangled: %q", e.Message)
+		_assert(e.Details["balance"] == "100", "unexpected details %v", e.Details)
+		_assert(errors.Is(e, &Error{Code: codeInsufficientFunds}), "errors.Is should match by code")
+
+		e = call("Account.Withdraw", -1)
+		_assert(e.Code == CodeUnknown && e.Message == "negative amount", "unexpected error %v", e)
+	})
+	t.Run("handle timeout", func(t *testing.T) {
+		e := call("Account.Slow", 500)
+		_assert(e.Code == CodeDeadlineExceeded, "expect DeadlineExceeded, got %s", e.Code)
+	})
+	t.Run("client timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := client.Call(ctx, "Account.Slow", 50, &reply)
+		_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+	})
+}
+
+func TestErrorCode(t *testing.T) {
+	_assert(ErrorCode(nil) == CodeOK, "nil should be OK")
+	_assert(ErrorCode(errors.New("x")) == CodeUnknown, "plain error should be Unknown")
+	_assert(ErrorCode(context.Canceled) == CodeCanceled, "context.Canceled should be Canceled")
+	_assert(ErrorCode(ErrShutdown) == CodeUnavailable, "ErrShutdown should be Unavailable")
+	_assert(!errors.Is(NewError(CodeUnavailable, "other"), ErrShutdown), "different message should not match")
+	_assert(codeInsufficientFunds.String() == "Application(1001)", "unexpected name %s", codeInsufficientFunds)
+}
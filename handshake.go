@@ -0,0 +1,147 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ProtocolVersion 当前协议版本
+	ProtocolVersion = 1
+	// MinProtocolVersion 服务端可兼容的最低协议版本，option 中未携带版本号的旧客户端不做握手回复
+	MinProtocolVersion = 1
+)
+
+// 未设置 ConnectTimeout 时等待握手回复的时长
+var defaultHandshakeTimeout = 10 * time.Second
+
+// 服务端支持的特性，客户端可据此决定是否启用依赖服务端支持的功能
+const (
+	FeatureMetadata         = "metadata"
+	FeatureStructuredErrors = "structured-errors"
+	FeatureCompression      = "compression"
+	// FeatureDeadline 服务端按请求头中的剩余超时时间取消处理
+	FeatureDeadline = "deadline"
+	// FeatureCancel 服务端支持客户端发送的取消帧
+	FeatureCancel = "cancel"
+	// FeatureGoAway 服务端关闭前会发送关闭通知
+	FeatureGoAway = "goaway"
+)
+
+var serverFeatures = []string{
+	FeatureMetadata, FeatureStructuredErrors, FeatureCompression, FeatureDeadline, FeatureCancel, FeatureGoAway,
+}
+
+// HandshakeResponse 服务端对客户端 option 的握手回复
+type HandshakeResponse struct {
+	// 是否接受连接，拒绝时 Reason 为拒绝原因
+	Accepted bool
+	Reason   string
+	// 协商后双方使用的协议版本
+	ProtocolVersion int
+	// 服务端支持的编解码类型、压缩算法及特性
+	Codecs       []codec.Type
+	Compressions []codec.Compression
+	Features     []string
+}
+
+// HasFeature 判断服务端是否支持 feature
+func (h *HandshakeResponse) HasFeature(feature string) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验客户端 option，返回编解码器构造函数及握手回复
+func (s *Server) negotiate(opt *Option) (codec.NewCodecFunc, *HandshakeResponse) {
+	res := &HandshakeResponse{
+		ProtocolVersion: ProtocolVersion,
+		Codecs:          s.codecTypes(),
+		Compressions:    codec.Compressions(),
+		Features:        serverFeatures,
+	}
+	reject := func(format string, a ...interface{}) (codec.NewCodecFunc, *HandshakeResponse) {
+		res.Reason = fmt.Sprintf(format, a...)
+		return nil, res
+	}
+
+	if opt.MagicNumber != MagicNumber {
+		return reject("invalid magic number %#x", opt.MagicNumber)
+	}
+	if opt.ProtocolVersion > 0 {
+		if opt.ProtocolVersion < MinProtocolVersion {
+			return reject("protocol version %d not supported, expect at least %d",
+				opt.ProtocolVersion, MinProtocolVersion)
+		}
+		// 客户端版本较低时按客户端版本通信
+		if opt.ProtocolVersion < res.ProtocolVersion {
+			res.ProtocolVersion = opt.ProtocolVersion
+		}
+	}
+
+	f, ok := codec.Lookup(opt.CodecType)
+	if !ok || !s.codecAllowed(opt.CodecType) {
+		return reject("codec type %q not supported", opt.CodecType)
+	}
+	f, err := codec.WithCompression(f, opt.Compression, opt.CompressThreshold)
+	if err != nil {
+		return reject("compression %q not supported", opt.Compression)
+	}
+
+	res.Accepted = true
+	return f, res
+}
+
+// 服务端允许使用的编解码类型
+func (s *Server) codecTypes() []codec.Type {
+	types := codec.Types()
+	if s.allowedCodecs == nil {
+		return types
+	}
+	res := make([]codec.Type, 0, len(s.allowedCodecs))
+	for _, t := range types {
+		if s.codecAllowed(t) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func (s *Server) codecAllowed(t codec.Type) bool {
+	if s.allowedCodecs == nil {
+		return true
+	}
+	_, ok := s.allowedCodecs[t]
+	return ok
+}
+
+// 读取服务端的握手回复，握手阶段的读取受 ConnectTimeout 限制，未设置时使用 defaultHandshakeTimeout，
+// 避免不回复握手的旧版本服务端导致连接一直阻塞
+func readHandshake(conn net.Conn, br *bufio.Reader, opt *Option) (*HandshakeResponse, error) {
+	timeout := opt.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, Errorf(CodeUnavailable, "rpc client: read handshake response error: %s", err)
+	}
+	var res HandshakeResponse
+	if err := json.Unmarshal(line, &res); err != nil {
+		return nil, Errorf(CodeUnavailable, "rpc client: invalid handshake response: %s", err)
+	}
+	if !res.Accepted {
+		return nil, Errorf(CodeUnavailable, "rpc client: handshake rejected by server: %s", res.Reason)
+	}
+	return &res, nil
+}
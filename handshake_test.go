@@ -0,0 +1,107 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	s := NewServer()
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+	addr := ls.Addr().String()
+
+	t.Run("accepted", func(t *testing.T) {
+		client, err := Dial("tcp", addr, &Option{CodecType: codec.JsonCodecType})
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		hs := client.Handshake()
+		_assert(hs != nil && hs.Accepted && hs.ProtocolVersion == ProtocolVersion, "unexpected handshake %+v", hs)
+		_assert(hs.HasFeature(FeatureStructuredErrors), "expect feature %s", FeatureStructuredErrors)
+		_assert(len(hs.Codecs) >= 3, "expect all codecs, got %v", hs.Codecs)
+	})
+	t.Run("unsupported codec", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		_assert(err == nil, "dial failed: %v", err)
+		defer conn.Close()
+
+		io.WriteString(conn, `{"MagicNumber":3927900,"CodecType":"application/x-unknown","ProtocolVersion":1}`+"\n")
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		_assert(err == nil, "read handshake failed: %v", err)
+		var hs HandshakeResponse
+		_assert(json.Unmarshal(line, &hs) == nil, "invalid handshake response %s", line)
+		_assert(!hs.Accepted && strings.Contains(hs.Reason, "application/x-unknown"), "unexpected handshake %+v", hs)
+	})
+	t.Run("invalid magic number", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		_assert(err == nil, "dial failed: %v", err)
+		defer conn.Close()
+
+		io.WriteString(conn, `{"MagicNumber":1,"ProtocolVersion":1}`+"\n")
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		_assert(err == nil, "read handshake failed: %v", err)
+		var hs HandshakeResponse
+		_assert(json.Unmarshal(line, &hs) == nil, "invalid handshake response %s", line)
+		_assert(!hs.Accepted && strings.Contains(hs.Reason, "magic number"), "unexpected handshake %+v", hs)
+	})
+
+	t.Run("rejected by server", func(t *testing.T) {
+		// 模拟拒绝连接的服务端
+		fake, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer fake.Close()
+		go func() {
+			conn, err := fake.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			bufio.NewReader(conn).ReadBytes('\n')
+			json.NewEncoder(conn).Encode(&HandshakeResponse{Reason: "server is full"})
+		}()
+
+		_, err := Dial("tcp", fake.Addr().String(), nil)
+		var e *Error
+		_assert(errors.As(err, &e) && e.Code == CodeUnavailable, "expect Unavailable, got %v", err)
+		_assert(strings.Contains(e.Message, "server is full"), "unclear reason %q", e.Message)
+	})
+
+	t.Run("legacy client", func(t *testing.T) {
+		// 旧协议不发送协议版本，服务端不回复握手，客户端直接发送请求
+		client, err := Dial("tcp", addr, &Option{LegacyProtocol: true})
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+		_assert(client.Handshake() == nil, "expect no handshake")
+		_assert(client.opt.ProtocolVersion == 0, "expect no protocol version sent, got %d", client.opt.ProtocolVersion)
+		_, err = CheckHealth(context.Background(), client, "")
+		_assert(err == nil, "call failed: %v", err)
+	})
+	t.Run("legacy server", func(t *testing.T) {
+		// 模拟不回复握手的旧版本服务端，未设置 ConnectTimeout 时同样不能一直阻塞
+		old := defaultHandshakeTimeout
+		defaultHandshakeTimeout = 100 * time.Millisecond
+		defer func() { defaultHandshakeTimeout = old }()
+
+		fake, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer fake.Close()
+		go func() {
+			conn, err := fake.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}()
+
+		_, err := Dial("tcp", fake.Addr().String(), &Option{})
+		_assert(ErrorCode(err) == CodeUnavailable, "expect Unavailable, got %v", err)
+	})
+}
@@ -0,0 +1,183 @@
+package GbankRPC
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// HealthServiceName 内置健康检查服务的名称
+const HealthServiceName = "_Health"
+
+// ServingStatus 服务的健康状态
+type ServingStatus int32
+
+const (
+	// StatusUnknown 服务不存在或状态未知
+	StatusUnknown ServingStatus = iota
+	StatusServing
+	StatusNotServing
+)
+
+func (s ServingStatus) String() string {
+	switch s {
+	case StatusUnknown:
+		return "UNKNOWN"
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	}
+	return "ServingStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+// HealthCheckArgs 健康检查参数，Service 为空时检查整个服务端
+type HealthCheckArgs struct {
+	Service string
+}
+
+// HealthCheckReply 健康检查结果
+type HealthCheckReply struct {
+	Status ServingStatus
+}
+
+// HealthWatchArgs Watch 的参数，Status 为调用方已知的状态
+type HealthWatchArgs struct {
+	Service string
+	Status  ServingStatus
+}
+
+// healthService 维护服务的健康状态，方法对应 _Health.Check 与 _Health.Watch
+type healthService struct {
+	s  *Server
+	mu sync.Mutex
+	// 应用显式设置的状态，key 为空表示整个服务端
+	statuses map[string]ServingStatus
+	// 关闭流程开始后全部服务均为 NOT_SERVING，不再接受设置
+	shutdown bool
+	// 状态变化时关闭并替换，用于唤醒 Watch
+	changed chan struct{}
+}
+
+func newHealthService(s *Server) *healthService {
+	return &healthService{
+		s:        s,
+		statuses: make(map[string]ServingStatus),
+		changed:  make(chan struct{}),
+	}
+}
+
+// 返回服务的当前状态及状态变化的通知 channel，ok 为 false 表示服务不存在
+func (h *healthService) status(service string) (ServingStatus, <-chan struct{}, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shutdown {
+		return StatusNotServing, h.changed, true
+	}
+	if status, ok := h.statuses[service]; ok {
+		return status, h.changed, true
+	}
+	// 未显式设置状态时，服务端及已注册的服务均视为可用
+	if service == "" {
+		return StatusServing, h.changed, true
+	}
+	if _, ok := h.s.serviceTable.Load(service); ok {
+		return StatusServing, h.changed, true
+	}
+	return StatusUnknown, h.changed, false
+}
+
+func (h *healthService) set(service string, status ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shutdown {
+		return
+	}
+	h.statuses[service] = status
+	h.notifyLocked()
+}
+
+func (h *healthService) setShutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shutdown {
+		return
+	}
+	h.shutdown = true
+	h.notifyLocked()
+}
+
+func (h *healthService) notifyLocked() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Check 返回服务的健康状态，服务不存在时返回 CodeNotFound 错误
+func (h *healthService) Check(args HealthCheckArgs, reply *HealthCheckReply) error {
+	status, _, ok := h.status(args.Service)
+	if !ok {
+		return NewError(CodeNotFound, "health: unknown service "+args.Service)
+	}
+	reply.Status = status
+	return nil
+}
+
+// Watch 阻塞至服务状态与 args.Status 不同时返回新状态，服务不存在时返回 UNKNOWN。
+// 状态未变化时请求会因超时返回 CodeDeadlineExceeded，调用方可重新发起 Watch
+func (h *healthService) Watch(ctx context.Context, args HealthWatchArgs, reply *HealthCheckReply) error {
+	for {
+		status, changed, _ := h.status(args.Service)
+		if status != args.Status {
+			reply.Status = status
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// SetServingStatus 设置服务的健康状态，service 为空时设置整个服务端的状态。
+// 服务端关闭流程开始后全部服务均为 NOT_SERVING，设置不再生效
+func (s *Server) SetServingStatus(service string, status ServingStatus) {
+	s.health.set(service, status)
+}
+
+// ServingStatus 返回服务的健康状态，service 为空时返回整个服务端的状态
+func (s *Server) ServingStatus(service string) ServingStatus {
+	status, _, _ := s.health.status(service)
+	return status
+}
+
+// healthHandler 以 http 提供健康检查，可通过 ?service= 指定服务。
+// SERVING 时返回 200，NOT_SERVING 时返回 503，服务不存在时返回 404
+type healthHandler struct {
+	*Server
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	status, _, ok := h.health.status(req.URL.Query().Get("service"))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+	case status != StatusServing:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	io.WriteString(w, status.String()+"\n")
+}
+
+// CheckHealth 通过 c 检查服务的健康状态，c 可以是 *Client 或 *xclient.XClient
+func CheckHealth(ctx context.Context, c Caller, service string) (ServingStatus, error) {
+	reply, err := Invoke[HealthCheckArgs, HealthCheckReply](ctx, c, HealthServiceName+".Check",
+		HealthCheckArgs{Service: service})
+	return reply.Status, err
+}
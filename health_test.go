@@ -0,0 +1,75 @@
+package GbankRPC
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	t.Run("check", func(t *testing.T) {
+		status, err := CheckHealth(context.Background(), client, "")
+		_assert(err == nil && status == StatusServing, "expect SERVING, got %s, err %v", status, err)
+		status, err = CheckHealth(context.Background(), client, "Foo")
+		_assert(err == nil && status == StatusServing, "expect SERVING, got %s, err %v", status, err)
+		_, err = CheckHealth(context.Background(), client, "Missing")
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+
+		s.SetServingStatus("Foo", StatusNotServing)
+		status, err = CheckHealth(context.Background(), client, "Foo")
+		_assert(err == nil && status == StatusNotServing, "expect NOT_SERVING, got %s, err %v", status, err)
+		s.SetServingStatus("Foo", StatusServing)
+	})
+	t.Run("watch", func(t *testing.T) {
+		time.AfterFunc(50*time.Millisecond, func() { s.SetServingStatus("Foo", StatusNotServing) })
+		var reply HealthCheckReply
+		err := client.Call(context.Background(), HealthServiceName+".Watch",
+			HealthWatchArgs{Service: "Foo", Status: StatusServing}, &reply)
+		_assert(err == nil && reply.Status == StatusNotServing, "expect NOT_SERVING, got %s, err %v", reply.Status, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = client.Call(ctx, HealthServiceName+".Watch", HealthWatchArgs{Service: "Foo", Status: StatusNotServing}, &reply)
+		_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+		s.SetServingStatus("Foo", StatusServing)
+	})
+	t.Run("unregister", func(t *testing.T) {
+		_assert(s.Unregister(HealthServiceName) != nil, "expect built-in service not removable")
+		_, err := CheckHealth(context.Background(), client, "")
+		_assert(err == nil, "health check failed: %v", err)
+	})
+	t.Run("http", func(t *testing.T) {
+		h := &healthHandler{s}
+		for _, tt := range []struct {
+			service string
+			code    int
+		}{{"", http.StatusOK}, {"Foo", http.StatusOK}, {"Missing", http.StatusNotFound}} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz?service="+tt.service, nil))
+			_assert(w.Code == tt.code, "service %q: expect %d, got %d", tt.service, tt.code, w.Code)
+		}
+
+		s.Close()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		_assert(w.Code == http.StatusServiceUnavailable, "expect 503 after close, got %d", w.Code)
+		_assert(s.ServingStatus("Foo") == StatusNotServing, "expect NOT_SERVING after close")
+	})
+	t.Run("disabled", func(t *testing.T) {
+		s := NewServer(WithHealth(false))
+		_, _, err := s.findServiceMethod(HealthServiceName + ".Check")
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+	})
+}
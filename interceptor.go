@@ -0,0 +1,99 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"context"
+	"reflect"
+)
+
+// ServerInfo 服务端拦截器可获取的请求信息
+type ServerInfo struct {
+	// 请求头的副本，包含客户端发送的元数据
+	Header        codec.Header
+	ServiceMethod string
+	Service       *Service
+	Method        *MethodType
+}
+
+// Handler 处理请求的函数，reply 需由处理函数原地填充
+type Handler func(ctx context.Context, args, reply interface{}) error
+
+// ServerInterceptor 服务端拦截器，调用 next 继续执行后续拦截器及服务方法，不调用则直接返回
+type ServerInterceptor func(ctx context.Context, info *ServerInfo, args, reply interface{}, next Handler) error
+
+// Invoker 发起调用的函数
+type Invoker func(ctx context.Context, serviceMethod string, args, reply interface{}) error
+
+// ClientInterceptor 客户端拦截器，调用 invoker 继续执行后续拦截器及实际调用
+type ClientInterceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error
+
+// ChainServerInterceptors 将多个服务端拦截器按顺序组合为一个，第一个拦截器最先执行
+func ChainServerInterceptors(interceptors ...ServerInterceptor) ServerInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+
+	return func(ctx context.Context, info *ServerInfo, args, reply interface{}, next Handler) error {
+		return interceptors[0](ctx, info, args, reply, chainServerHandler(interceptors, 0, info, next))
+	}
+}
+
+// 返回执行第 i 个之后的拦截器及 final 的处理函数
+func chainServerHandler(interceptors []ServerInterceptor, i int, info *ServerInfo, final Handler) Handler {
+	if i == len(interceptors)-1 {
+		return final
+	}
+	return func(ctx context.Context, args, reply interface{}) error {
+		return interceptors[i+1](ctx, info, args, reply, chainServerHandler(interceptors, i+1, info, final))
+	}
+}
+
+// ChainClientInterceptors 将多个客户端拦截器按顺序组合为一个，第一个拦截器最先执行
+func ChainClientInterceptors(interceptors ...ClientInterceptor) ClientInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		return interceptors[0](ctx, serviceMethod, args, reply, chainClientInvoker(interceptors, 0, invoker))
+	}
+}
+
+// 返回执行第 i 个之后的拦截器及 final 的调用函数
+func chainClientInvoker(interceptors []ClientInterceptor, i int, final Invoker) Invoker {
+	if i == len(interceptors)-1 {
+		return final
+	}
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+		return interceptors[i+1](ctx, serviceMethod, args, reply, chainClientInvoker(interceptors, i+1, final))
+	}
+}
+
+// 经过拦截器调用服务方法，拦截器中的 panic 同样转换为 CodeInternal 错误
+func (s *Server) invoke(ctx context.Context, req *Request, h codec.Header) (err error) {
+	if s.interceptor == nil {
+		return req.service.CallContext(ctx, req.method, req.args, req.reply)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = handlePanic(ctx, s.logger, h.ServiceMethod, r, s.panicHandler)
+		}
+	}()
+
+	info := &ServerInfo{
+		Header:        h,
+		ServiceMethod: h.ServiceMethod,
+		Service:       req.service,
+		Method:        req.method,
+	}
+	return s.interceptor(ctx, info, req.args.Interface(), req.reply.Interface(),
+		func(ctx context.Context, args, reply interface{}) error {
+			return req.service.CallContext(ctx, req.method, reflect.ValueOf(args), reflect.ValueOf(reply))
+		})
+}
@@ -0,0 +1,92 @@
+package GbankRPC
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestInterceptor(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		trace = append(trace, s)
+	}
+	takeTrace := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		res := trace
+		trace = nil
+		return res
+	}
+
+	// 请求元数据中没有 token 时直接拒绝
+	auth := func(ctx context.Context, info *ServerInfo, args, reply interface{}, next Handler) error {
+		record("auth")
+		if info.Header.Metadata["token"] == "" {
+			return NewError(CodeInvalidArgument, "missing token")
+		}
+		return next(ctx, args, reply)
+	}
+	logging := func(ctx context.Context, info *ServerInfo, args, reply interface{}, next Handler) error {
+		record("server " + info.ServiceMethod)
+		err := next(ctx, args, reply)
+		record("server done")
+		return err
+	}
+
+	s := NewServer(WithServerInterceptors(logging, auth))
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	clientInterceptor := func(name string) ClientInterceptor {
+		return func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+			record("client " + name)
+			return invoker(ctx, serviceMethod, args, reply)
+		}
+	}
+	opt := *DefaultOption
+	opt.Interceptors = []ClientInterceptor{clientInterceptor("a"), clientInterceptor("b")}
+	client, err := Dial("tcp", ls.Addr().String(), &opt)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	t.Run("chain order", func(t *testing.T) {
+		ctx := AppendMetadata(context.Background(), "token", "secret")
+		var reply int
+		err := client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "expect 3, got %d, err %v", reply, err)
+		expect := []string{"client a", "client b", "server Foo.Sum", "auth", "server done"}
+		got := takeTrace()
+		_assert(reflect.DeepEqual(got, expect), "expect %v, got %v", expect, got)
+	})
+	t.Run("rejected", func(t *testing.T) {
+		var reply int
+		err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(ErrorCode(err) == CodeInvalidArgument, "expect InvalidArgument, got %v", err)
+		takeTrace()
+	})
+	t.Run("client short circuit", func(t *testing.T) {
+		errDenied := errors.New("denied")
+		opt := *DefaultOption
+		opt.Interceptors = []ClientInterceptor{
+			func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+				return errDenied
+			},
+		}
+		client, err := Dial("tcp", ls.Addr().String(), &opt)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		var reply int
+		err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == errDenied, "expect errDenied, got %v", err)
+		_assert(len(takeTrace()) == 0, "expect server not called")
+	})
+}
@@ -0,0 +1,32 @@
+package GbankRPC
+
+import "context"
+
+// Caller 发起调用的客户端，*Client 与 *xclient.XClient 均实现了该接口
+type Caller interface {
+	Call(ctx context.Context, serviceMethod string, args, reply interface{}) error
+}
+
+var _ Caller = (*Client)(nil)
+
+// Invoke 以类型安全的方式调用 serviceMethod，请求与响应类型在编译期确定
+func Invoke[Req, Resp any](ctx context.Context, c Caller, serviceMethod string, req Req) (Resp, error) {
+	var resp Resp
+	err := c.Call(ctx, serviceMethod, req, &resp)
+	return resp, err
+}
+
+// MethodRef 绑定了请求与响应类型的方法引用，通常声明为包级变量复用
+type MethodRef[Req, Resp any] struct {
+	ServiceMethod string
+}
+
+// NewMethodRef 新建 serviceMethod 的方法引用
+func NewMethodRef[Req, Resp any](serviceMethod string) MethodRef[Req, Resp] {
+	return MethodRef[Req, Resp]{ServiceMethod: serviceMethod}
+}
+
+// Invoke 通过 c 调用引用的方法
+func (m MethodRef[Req, Resp]) Invoke(ctx context.Context, c Caller, req Req) (Resp, error) {
+	return Invoke[Req, Resp](ctx, c, m.ServiceMethod, req)
+}
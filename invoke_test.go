@@ -0,0 +1,36 @@
+package GbankRPC
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+var fooSum = NewMethodRef[Args, int]("Foo.Sum")
+
+func TestInvoke(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	_assert(s.RegisterFunc("Names.Split", func(args string, reply *[]string) error {
+		*reply = append(*reply, args[:1], args[1:])
+		return nil
+	}) == nil, "failed to register Names.Split")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	sum, err := Invoke[Args, int](context.Background(), client, "Foo.Sum", Args{Num1: 1, Num2: 2})
+	_assert(err == nil && sum == 3, "expect 3, got %d, err %v", sum, err)
+
+	sum, err = fooSum.Invoke(context.Background(), client, Args{Num1: 3, Num2: 4})
+	_assert(err == nil && sum == 7, "expect 7, got %d, err %v", sum, err)
+
+	parts, err := Invoke[string, []string](context.Background(), client, "Names.Split", "ab")
+	_assert(err == nil && len(parts) == 2 && parts[1] == "b", "unexpected reply %v, err %v", parts, err)
+
+	_, err = Invoke[Args, int](context.Background(), client, "Foo.Missing", Args{})
+	_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+}
@@ -0,0 +1,171 @@
+// Package logging 定义框架各组件使用的结构化日志接口，提供丢弃全部日志的实现、
+// 每条日志输出一行 json 的实现以及适配标准库 log 的实现。
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l >= LevelDebug && l <= LevelError {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel 解析日志级别名称，不区分大小写
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("logging: unknown level %q", s)
+}
+
+// Logger 结构化日志，kv 为 key, value 交替的字段，key 应为 string，需支持并发调用
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+	// With 返回每条日志都附加 kv 字段的 Logger
+	With(kv ...interface{}) Logger
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (l nopLogger) With(...interface{}) Logger { return l }
+
+// Nop 返回丢弃全部日志的 Logger，为客户端等调用方可感知错误的组件的默认值
+func Nop() Logger {
+	return nopLogger{}
+}
+
+// Default 返回只将 Error 级别的日志写入标准库 log 默认 Logger 的 Logger，
+// 为服务端等错误无法返回给调用方的组件的默认值，避免 panic 等错误被静默丢弃
+func Default() Logger {
+	return NewStd(log.Default(), LevelError)
+}
+
+// OrNop logger 为空时返回 Nop()
+func OrNop(logger Logger) Logger {
+	if logger == nil {
+		return Nop()
+	}
+	return logger
+}
+
+// 各实现共用的级别过滤及字段合并
+type base struct {
+	min    Level
+	fields []interface{}
+	out    func(level Level, msg string, fields []interface{})
+}
+
+func (b *base) log(level Level, msg string, kv []interface{}) {
+	if level < b.min {
+		return
+	}
+	fields := kv
+	if len(b.fields) > 0 {
+		fields = append(append(make([]interface{}, 0, len(b.fields)+len(kv)), b.fields...), kv...)
+	}
+	b.out(level, msg, fields)
+}
+
+func (b *base) Debug(msg string, kv ...interface{}) { b.log(LevelDebug, msg, kv) }
+func (b *base) Info(msg string, kv ...interface{})  { b.log(LevelInfo, msg, kv) }
+func (b *base) Warn(msg string, kv ...interface{})  { b.log(LevelWarn, msg, kv) }
+func (b *base) Error(msg string, kv ...interface{}) { b.log(LevelError, msg, kv) }
+
+func (b *base) With(kv ...interface{}) Logger {
+	fields := append(append(make([]interface{}, 0, len(b.fields)+len(kv)), b.fields...), kv...)
+	return &base{min: b.min, fields: fields, out: b.out}
+}
+
+// 将 kv 依次交给 f，key 不是 string 时格式化为 string，缺少 value 时以 "!MISSING" 补齐
+func eachField(kv []interface{}, f func(key string, value interface{})) {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value interface{} = "!MISSING"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		f(key, value)
+	}
+}
+
+// 转换为可编码为 json 的值，error 及 fmt.Stringer 使用其字符串形式
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case json.Marshaler, nil, string, bool, int, int64, uint64, float64:
+		return v
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// NewJSON 返回向 w 输出的 Logger，每条日志为一行 json，包含 time、level、msg 及全部字段，低于 min 的日志被丢弃
+func NewJSON(w io.Writer, min Level) Logger {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return &base{min: min, out: func(level Level, msg string, fields []interface{}) {
+		entry := make(map[string]interface{}, 3+len(fields)/2)
+		eachField(fields, func(key string, value interface{}) {
+			entry[key] = jsonValue(value)
+		})
+		entry["time"] = time.Now().Format(time.RFC3339Nano)
+		entry["level"] = level.String()
+		entry["msg"] = msg
+
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(entry)
+	}}
+}
+
+// NewStd 返回写入标准库 log.Logger 的 Logger，字段以 key=value 的形式追加在消息之后，低于 min 的日志被丢弃
+func NewStd(logger *log.Logger, min Level) Logger {
+	return &base{min: min, out: func(level Level, msg string, fields []interface{}) {
+		var sb strings.Builder
+		sb.WriteString(level.String())
+		sb.WriteByte(' ')
+		sb.WriteString(msg)
+		eachField(fields, func(key string, value interface{}) {
+			fmt.Fprintf(&sb, " %s=%v", key, value)
+		})
+		logger.Output(4, sb.String())
+	}}
+}
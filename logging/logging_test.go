@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var res []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSON(&buf, LevelInfo)
+	logger.Debug("dropped")
+	conn := logger.With("remote", "127.0.0.1:1234")
+	conn.Warn("write error", "method", "Foo.Sum", "seq", 3, "err", errors.New("broken pipe"))
+	logger.Error("odd", "key")
+
+	lines := decodeLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %d", len(lines))
+	}
+	expect := map[string]interface{}{
+		"level": "WARN", "msg": "write error", "remote": "127.0.0.1:1234",
+		"method": "Foo.Sum", "seq": float64(3), "err": "broken pipe",
+	}
+	for k, v := range expect {
+		if lines[0][k] != v {
+			t.Errorf("%s: expect %v, got %v", k, v, lines[0][k])
+		}
+	}
+	if _, ok := lines[0]["time"]; !ok {
+		t.Error("expect time field")
+	}
+	if lines[1]["key"] != "!MISSING" || lines[1]["remote"] != nil {
+		t.Errorf("unexpected line %v", lines[1])
+	}
+}
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStd(log.New(&buf, "", 0), LevelWarn)
+	logger.Info("dropped")
+	logger.With("remote", "a").Error("panic recovered", "method", "Foo.Sum")
+	if got := buf.String(); got != "ERROR panic recovered remote=a method=Foo.Sum\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestNop(t *testing.T) {
+	logger := OrNop(nil)
+	logger.With("k", "v").Error("ignored")
+	if _, ok := logger.(nopLogger); !ok {
+		t.Fatalf("expect nop logger, got %T", logger)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	logger := Default()
+	logger.Warn("dropped")
+	logger.Error("accept error", "err", "closed")
+	if got := buf.String(); got != "ERROR accept error err=closed\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		got, err := ParseLevel(strings.ToLower(l.String()))
+		if err != nil || got != l {
+			t.Errorf("ParseLevel(%s): got %v, err %v", l, got, err)
+		}
+	}
+	if _, err := ParseLevel("fatal"); err == nil {
+		t.Error("expect error for unknown level")
+	}
+}
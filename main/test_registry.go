@@ -97,7 +97,8 @@ func broadcastTestRegistry(registry string) {
 			rpcCallTestRegistry(context.Background(), xClient, "FooRegistry.Sum", "broadcast",
 				&ArgFooRegistry{Num1: index, Num2: index * index})
 			// expect 2 - 5 timeout
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*2)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
 			rpcCallTestRegistry(ctx, xClient, "FooRegistry.Sleep", "broadcast",
 				&ArgFooRegistry{Num1: index, Num2: index * index})
 		}(i)
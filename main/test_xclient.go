@@ -82,7 +82,8 @@ func broadcast(addr1, addr2 string) {
 			defer wg.Done()
 			rpcCall(context.Background(), xClient, "FooXClient.Sum", "broadcast", &ArgXClient{Num1: index, Num2: index * index})
 			// expect 2 - 5 timeout
-			ctx, _ := context.WithTimeout(context.Background(), time.Second*2)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
 			rpcCall(ctx, xClient, "FooXClient.Sleep", "broadcast", &ArgXClient{Num1: index, Num2: index * index})
 		}(i)
 	}
@@ -0,0 +1,106 @@
+package GbankRPC
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type outgoingMetadataKey struct{}
+type replyMetadataKey struct{}
+type serverMetadataKey struct{}
+
+// 服务端处理请求时的元数据
+type serverMetadata struct {
+	// 客户端随请求发送的元数据
+	incoming map[string]string
+	mu       sync.Mutex
+	// 服务端随响应返回的元数据
+	reply map[string]string
+}
+
+// WithMetadata 设置随请求发送的元数据，与 ctx 中已有的元数据合并，同名 key 以 md 为准
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	old := OutgoingMetadata(ctx)
+	merged := make(map[string]string, len(old)+len(md))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, outgoingMetadataKey{}, merged)
+}
+
+// AppendMetadata 以 key, value 交替的形式追加随请求发送的元数据
+func AppendMetadata(ctx context.Context, kv ...string) context.Context {
+	if len(kv)%2 == 1 {
+		panic("GbankRPC: AppendMetadata got an odd number of arguments")
+	}
+	md := make(map[string]string, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return WithMetadata(ctx, md)
+}
+
+// OutgoingMetadata 获取 ctx 中随请求发送的元数据，返回值不可修改
+func OutgoingMetadata(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(outgoingMetadataKey{}).(map[string]string)
+	return md
+}
+
+// WithReplyMetadata 注册用于接收响应元数据的 map，Client.Call 返回后服务端设置的元数据会写入 md
+func WithReplyMetadata(ctx context.Context, md map[string]string) context.Context {
+	return context.WithValue(ctx, replyMetadataKey{}, md)
+}
+
+// IncomingMetadata 在服务端方法中获取客户端随请求发送的元数据
+func IncomingMetadata(ctx context.Context) map[string]string {
+	sm, ok := ctx.Value(serverMetadataKey{}).(*serverMetadata)
+	if !ok {
+		return nil
+	}
+	res := make(map[string]string, len(sm.incoming))
+	for k, v := range sm.incoming {
+		res[k] = v
+	}
+	return res
+}
+
+// SetReplyMetadata 在服务端方法中设置随响应返回的元数据
+func SetReplyMetadata(ctx context.Context, key, value string) error {
+	sm, ok := ctx.Value(serverMetadataKey{}).(*serverMetadata)
+	if !ok {
+		return errors.New("SetReplyMetadata rpc server: not a server context")
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.reply == nil {
+		sm.reply = make(map[string]string)
+	}
+	sm.reply[key] = value
+	return nil
+}
+
+// 构造服务端处理请求的 ctx
+func newServerMetadataContext(ctx context.Context, incoming map[string]string) (context.Context, *serverMetadata) {
+	sm := &serverMetadata{incoming: incoming}
+	return context.WithValue(ctx, serverMetadataKey{}, sm), sm
+}
+
+// 获取服务端设置的响应元数据
+func (sm *serverMetadata) replyMetadata() map[string]string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if len(sm.reply) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(sm.reply))
+	for k, v := range sm.reply {
+		res[k] = v
+	}
+	return res
+}
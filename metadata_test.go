@@ -0,0 +1,71 @@
+package GbankRPC
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+type Echo int
+
+// Tenant 返回请求元数据中的 tenant，并通过响应元数据回传 caller
+func (e Echo) Tenant(ctx context.Context, args int, reply *string) error {
+	md := IncomingMetadata(ctx)
+	*reply = md["tenant"]
+	return SetReplyMetadata(ctx, "served-for", md["caller"])
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("outgoing", func(t *testing.T) {
+		ctx := WithMetadata(context.Background(), map[string]string{"tenant": "bank-a", "caller": "web"})
+		ctx = AppendMetadata(ctx, "caller", "gateway")
+		md := OutgoingMetadata(ctx)
+		_assert(len(md) == 2 && md["tenant"] == "bank-a" && md["caller"] == "gateway", "unexpected metadata %v", md)
+		_assert(OutgoingMetadata(context.Background()) == nil, "expect nil outgoing metadata")
+	})
+	t.Run("server", func(t *testing.T) {
+		ctx, sm := newServerMetadataContext(context.Background(), map[string]string{"tenant": "bank-a"})
+		md := IncomingMetadata(ctx)
+		md["tenant"] = "changed"
+		_assert(IncomingMetadata(ctx)["tenant"] == "bank-a", "IncomingMetadata should return a copy")
+		_assert(sm.replyMetadata() == nil, "expect nil reply metadata")
+
+		_assert(SetReplyMetadata(ctx, "served-for", "gateway") == nil, "SetReplyMetadata failed")
+		reply := sm.replyMetadata()
+		_assert(len(reply) == 1 && reply["served-for"] == "gateway", "unexpected reply metadata %v", reply)
+	})
+	t.Run("not a server context", func(t *testing.T) {
+		_assert(IncomingMetadata(context.Background()) == nil, "expect nil incoming metadata")
+		_assert(SetReplyMetadata(context.Background(), "k", "v") != nil, "expect error")
+	})
+}
+
+func TestMetadata_ContextMethod(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Echo)) == nil, "failed to register Echo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	t.Run("call", func(t *testing.T) {
+		ctx := WithMetadata(context.Background(), map[string]string{"tenant": "bank-a"})
+		ctx = AppendMetadata(ctx, "caller", "gateway")
+		replyMD := make(map[string]string)
+		ctx = WithReplyMetadata(ctx, replyMD)
+
+		var reply string
+		err := client.Call(ctx, "Echo.Tenant", 1, &reply)
+		_assert(err == nil && reply == "bank-a", "expect bank-a, got %q, err %v", reply, err)
+		_assert(replyMD["served-for"] == "gateway", "unexpected reply metadata %v", replyMD)
+	})
+	t.Run("go", func(t *testing.T) {
+		ctx := AppendMetadata(context.Background(), "tenant", "bank-b")
+		var reply string
+		call := <-client.GoContext(ctx, "Echo.Tenant", 1, &reply, nil).Done
+		_assert(call.Err == nil && reply == "bank-b", "expect bank-b, got %q, err %v", reply, call.Err)
+		_assert(call.ReplyMetadata["served-for"] == "", "unexpected reply metadata %v", call.ReplyMetadata)
+	})
+}
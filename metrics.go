@@ -0,0 +1,71 @@
+package GbankRPC
+
+import (
+	"GbankRPC/metrics"
+	"sync/atomic"
+)
+
+// RegisterMetrics 注册与服务端指标一同输出的其他指标，如 XClient 及注册中心
+func (s *Server) RegisterMetrics(collectors ...metrics.Collector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collectors = append(s.collectors, collectors...)
+}
+
+// WriteMetrics 输出服务端的方法统计、连接数及处理中的请求数，以及通过 RegisterMetrics 注册的指标
+func (s *Server) WriteMetrics(w *metrics.Writer) {
+	stats := s.Stats()
+
+	w.Header("gbankrpc_server_requests_total", metrics.TypeCounter, "Requests handled by the server, by method and code.")
+	for _, st := range stats {
+		for code, n := range st.Codes {
+			w.Sample("gbankrpc_server_requests_total", float64(n), "method", st.ServiceMethod, "code", code.String())
+		}
+	}
+
+	bounds := make([]float64, len(latencyBuckets))
+	for i, b := range latencyBuckets {
+		bounds[i] = b.Seconds()
+	}
+	w.Header("gbankrpc_server_request_duration_seconds", metrics.TypeHistogram, "Request handling latency.")
+	for _, st := range stats {
+		w.Histogram("gbankrpc_server_request_duration_seconds", bounds, st.Latency.Counts, st.Latency.Sum.Seconds(),
+			"method", st.ServiceMethod)
+	}
+
+	methodSamples := []struct {
+		name, typ, help string
+		value           func(st *MethodStats) float64
+	}{
+		{"gbankrpc_server_requests_in_flight", metrics.TypeGauge, "Requests currently being handled.",
+			func(st *MethodStats) float64 { return float64(st.InFlight) }},
+		{"gbankrpc_server_timeouts_total", metrics.TypeCounter, "Requests exceeding the handle timeout or client deadline.",
+			func(st *MethodStats) float64 { return float64(st.Timeouts) }},
+		{"gbankrpc_server_panics_total", metrics.TypeCounter, "Panics recovered in service methods.",
+			func(st *MethodStats) float64 { return float64(st.Panics) }},
+		{"gbankrpc_server_request_bytes_total", metrics.TypeCounter, "Bytes read for requests.",
+			func(st *MethodStats) float64 { return float64(st.RequestBytes) }},
+		{"gbankrpc_server_response_bytes_total", metrics.TypeCounter, "Bytes written for responses.",
+			func(st *MethodStats) float64 { return float64(st.ResponseBytes) }},
+	}
+	for _, m := range methodSamples {
+		w.Header(m.name, m.typ, m.help)
+		for i := range stats {
+			w.Sample(m.name, m.value(&stats[i]), "method", stats[i].ServiceMethod)
+		}
+	}
+
+	s.mu.Lock()
+	conns := len(s.conns)
+	collectors := append([]metrics.Collector(nil), s.collectors...)
+	s.mu.Unlock()
+
+	w.Header("gbankrpc_server_connections", metrics.TypeGauge, "Open connections.")
+	w.Sample("gbankrpc_server_connections", float64(conns))
+	w.Header("gbankrpc_server_active_requests", metrics.TypeGauge, "Requests being handled on all connections.")
+	w.Sample("gbankrpc_server_active_requests", float64(atomic.LoadInt64(&s.activeRequests)))
+
+	for _, c := range collectors {
+		c.WriteMetrics(w)
+	}
+}
@@ -0,0 +1,143 @@
+// Package metrics 以 Prometheus 文本格式输出指标，不依赖第三方库。
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Collector 可输出指标的组件
+type Collector interface {
+	WriteMetrics(w *Writer)
+}
+
+// Writer 按 Prometheus 文本格式写入指标，写入错误保存在 Err 中，之后的写入均忽略
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter 新建写入 w 的 Writer，写入完成后需调用 Flush
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Header 写入指标的说明及类型，同名指标的样本需紧随其后写入
+func (w *Writer) Header(name, typ, help string) {
+	w.writeString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.writeString("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample 写入一个样本，labels 为 key、value 交替的标签
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.writeString(name)
+	w.writeLabels(labels, "", "")
+	w.writeString(" " + formatFloat(value) + "\n")
+}
+
+// Histogram 写入直方图的全部样本，counts 为各个桶内（非累计）的数量，
+// 比 bounds 多一个元素表示超过全部上界的数量
+func (w *Writer) Histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		w.writeString(name + "_bucket")
+		w.writeLabels(labels, "le", formatFloat(bound))
+		w.writeString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+	}
+	cumulative += counts[len(bounds)]
+	w.writeString(name + "_bucket")
+	w.writeLabels(labels, "le", "+Inf")
+	w.writeString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+
+	w.Sample(name+"_sum", sum, labels...)
+	w.Sample(name+"_count", float64(cumulative), labels...)
+}
+
+// Flush 将缓存的数据写入底层 io.Writer，返回写入过程中的第一个错误
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func (w *Writer) writeLabels(labels []string, extraKey, extraValue string) {
+	if len(labels) == 0 && extraKey == "" {
+		return
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+	if extraKey != "" {
+		if len(labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraKey + `="` + escapeLabel(extraValue) + `"`)
+	}
+	b.WriteByte('}')
+	w.writeString(b.String())
+}
+
+func (w *Writer) writeString(s string) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.WriteString(s)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Handler 返回依次输出 collectors 指标的 http.Handler
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", ContentType)
+		w := NewWriter(rw)
+		for _, c := range collectors {
+			c.WriteMetrics(w)
+		}
+		w.Flush()
+	})
+}
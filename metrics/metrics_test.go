@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header("rpc_requests_total", TypeCounter, "Total requests.\nBy method.")
+	w.Sample("rpc_requests_total", 3, "method", `Foo."Sum"`, "code", "OK")
+	w.Sample("rpc_up", 1)
+	w.Sample("rpc_inf", math.Inf(1))
+	w.Header("rpc_latency_seconds", TypeHistogram, "Latency.")
+	w.Histogram("rpc_latency_seconds", []float64{0.1, 1}, []uint64{1, 2, 1}, 2.5, "method", "Foo.Sum")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `# HELP rpc_requests_total Total requests.\nBy method.
+# TYPE rpc_requests_total counter
+rpc_requests_total{method="Foo.\"Sum\"",code="OK"} 3
+rpc_up 1
+rpc_inf +Inf
+# HELP rpc_latency_seconds Latency.
+# TYPE rpc_latency_seconds histogram
+rpc_latency_seconds_bucket{method="Foo.Sum",le="0.1"} 1
+rpc_latency_seconds_bucket{method="Foo.Sum",le="1"} 3
+rpc_latency_seconds_bucket{method="Foo.Sum",le="+Inf"} 4
+rpc_latency_seconds_sum{method="Foo.Sum"} 2.5
+rpc_latency_seconds_count{method="Foo.Sum"} 4
+`
+	if buf.String() != expect {
+		t.Errorf("expect:\n%s\ngot:\n%s", expect, buf.String())
+	}
+}
+
+type constCollector float64
+
+func (c constCollector) WriteMetrics(w *Writer) {
+	w.Sample("const", float64(c))
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(constCollector(1), constCollector(2)).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if rec.Body.String() != "const 1\nconst 2\n" {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+}
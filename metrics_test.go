@@ -0,0 +1,45 @@
+package GbankRPC
+
+import (
+	"GbankRPC/metrics"
+	"GbankRPC/registry"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_Metrics(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	_assert(client.Call(context.Background(), "Account.Withdraw", 10, &reply) == nil, "withdraw failed")
+	_ = client.Call(context.Background(), "Account.Withdraw", 1000, &reply)
+
+	waitStats(t, s, "Account.Withdraw", 2)
+	reg := registry.NewGBankRegistry(0)
+	s.RegisterMetrics(reg)
+
+	rec := httptest.NewRecorder()
+	metrics.Handler(s).ServeHTTP(rec, httptest.NewRequest("GET", defaultMetricsPath, nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`gbankrpc_server_requests_total{method="Account.Withdraw",code="OK"} 1`,
+		`gbankrpc_server_requests_total{method="Account.Withdraw",code="Application(1001)"} 1`,
+		`gbankrpc_server_request_duration_seconds_count{method="Account.Withdraw"} 2`,
+		`gbankrpc_server_request_duration_seconds_bucket{method="Account.Withdraw",le="+Inf"} 2`,
+		`gbankrpc_server_requests_in_flight{method="Account.Slow"} 0`,
+		`gbankrpc_server_connections 1`,
+		`gbankrpc_registry_instances 0`,
+	} {
+		_assert(strings.Contains(body, line+"\n"), "missing %q in:\n%s", line, body)
+	}
+}
@@ -0,0 +1,115 @@
+package GbankRPC
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ReflectionServiceName 内置反射服务的名称，客户端可通过该服务查询服务端提供的服务及方法签名
+const ReflectionServiceName = "_Reflection"
+
+// ServiceDescriptor 服务及其方法名
+type ServiceDescriptor struct {
+	Name    string
+	Methods []string
+}
+
+// ListServicesArgs ListServices 的参数
+type ListServicesArgs struct{}
+
+// ListServicesReply ListServices 的返回值，按服务名排序
+type ListServicesReply struct {
+	Services []ServiceDescriptor
+}
+
+// MethodDescriptor 方法签名，Reply 为 reply 指针指向的类型
+type MethodDescriptor struct {
+	ServiceMethod string
+	WithContext   bool
+	Arg           TypeDescriptor
+	Reply         TypeDescriptor
+}
+
+// TypeDescriptor 类型的结构描述
+type TypeDescriptor struct {
+	// Go 中的类型名，如 GbankRPC.Args、[]string
+	Name string
+	// reflect.Kind 的名称，如 struct、slice、int
+	Kind string
+	// 指针、切片、数组及 map 的元素类型
+	Elem *TypeDescriptor
+	// map 的 key 类型
+	Key *TypeDescriptor
+	// 结构体的可导出字段，结构体递归引用自身时第二次出现不再展开
+	Fields []FieldDescriptor
+}
+
+// FieldDescriptor 结构体字段
+type FieldDescriptor struct {
+	Name string
+	Type TypeDescriptor
+}
+
+// 反射服务，方法对应 _Reflection.ListServices 与 _Reflection.DescribeMethod
+type reflectionService struct {
+	s *Server
+}
+
+// ListServices 返回全部已注册的服务
+func (r *reflectionService) ListServices(args ListServicesArgs, reply *ListServicesReply) error {
+	r.s.serviceTable.Range(func(key, val interface{}) bool {
+		service := val.(*Service)
+		desc := ServiceDescriptor{Name: key.(string)}
+		for name := range service.methods {
+			desc.Methods = append(desc.Methods, name)
+		}
+		sort.Strings(desc.Methods)
+		reply.Services = append(reply.Services, desc)
+		return true
+	})
+	sort.Slice(reply.Services, func(i, j int) bool { return reply.Services[i].Name < reply.Services[j].Name })
+	return nil
+}
+
+// DescribeMethod 返回 serviceMethod 的参数及返回值类型
+func (r *reflectionService) DescribeMethod(serviceMethod string, reply *MethodDescriptor) error {
+	_, method, err := r.s.findServiceMethod(serviceMethod)
+	if err != nil {
+		return err
+	}
+
+	reply.ServiceMethod = serviceMethod
+	reply.WithContext = method.withContext
+	reply.Arg = describeType(method.ArgType, make(map[reflect.Type]bool))
+	reply.Reply = describeType(method.ReplyType.Elem(), make(map[reflect.Type]bool))
+	return nil
+}
+
+// 描述类型结构，visiting 记录正在展开的结构体，防止递归类型无限展开
+func describeType(t reflect.Type, visiting map[reflect.Type]bool) TypeDescriptor {
+	res := TypeDescriptor{Name: t.String(), Kind: t.Kind().String()}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		elem := describeType(t.Elem(), visiting)
+		res.Elem = &elem
+	case reflect.Map:
+		key, elem := describeType(t.Key(), visiting), describeType(t.Elem(), visiting)
+		res.Key, res.Elem = &key, &elem
+	case reflect.Struct:
+		if visiting[t] {
+			return res
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			res.Fields = append(res.Fields, FieldDescriptor{Name: field.Name, Type: describeType(field.Type, visiting)})
+		}
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package GbankRPC
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// Node 递归引用自身的类型
+type Node struct {
+	Value    string
+	Children []*Node
+	Attrs    map[string]int
+	parent   *Node
+}
+
+type Forest int
+
+func (f Forest) Tree(ctx context.Context, args Node, reply *[]string) error {
+	return nil
+}
+
+func TestReflection(t *testing.T) {
+	s := NewServer(WithReflection(true))
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	_assert(s.RegisterService(new(Forest)) == nil, "failed to register Forest")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	t.Run("list services", func(t *testing.T) {
+		var reply ListServicesReply
+		err := client.Call(context.Background(), ReflectionServiceName+".ListServices", ListServicesArgs{}, &reply)
+		_assert(err == nil, "list services failed: %v", err)
+		_assert(len(reply.Services) == 4, "expect 4 services, got %v", reply.Services)
+		foo := reply.Services[0]
+		_assert(foo.Name == "Foo" && len(foo.Methods) == 1 && foo.Methods[0] == "Sum", "unexpected service %v", foo)
+		_assert(reply.Services[1].Name == "Forest", "unexpected service %v", reply.Services[1])
+		_assert(reply.Services[2].Name == HealthServiceName, "unexpected service %v", reply.Services[2])
+		_assert(reply.Services[3].Name == ReflectionServiceName, "unexpected service %v", reply.Services[3])
+	})
+	t.Run("describe method", func(t *testing.T) {
+		var desc MethodDescriptor
+		err := client.Call(context.Background(), ReflectionServiceName+".DescribeMethod", "Forest.Tree", &desc)
+		_assert(err == nil, "describe method failed: %v", err)
+		_assert(desc.WithContext && desc.Arg.Kind == "struct" && desc.Arg.Name == "GbankRPC.Node",
+			"unexpected arg %+v", desc.Arg)
+		_assert(len(desc.Arg.Fields) == 3, "expect unexported field skipped, got %+v", desc.Arg.Fields)
+
+		children := desc.Arg.Fields[1].Type
+		_assert(children.Kind == "slice" && children.Elem.Kind == "ptr" && children.Elem.Elem.Name == "GbankRPC.Node",
+			"unexpected children %+v", children)
+		_assert(len(children.Elem.Elem.Fields) == 0, "expect recursive type not expanded")
+		attrs := desc.Arg.Fields[2].Type
+		_assert(attrs.Key.Kind == "string" && attrs.Elem.Kind == "int", "unexpected attrs %+v", attrs)
+		_assert(desc.Reply.Kind == "slice" && desc.Reply.Elem.Kind == "string", "unexpected reply %+v", desc.Reply)
+
+		err = client.Call(context.Background(), ReflectionServiceName+".DescribeMethod", "Forest.Missing", &desc)
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+	})
+	t.Run("disabled by default", func(t *testing.T) {
+		s := NewServer()
+		_, _, err := s.findServiceMethod(ReflectionServiceName + ".ListServices")
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+	})
+}
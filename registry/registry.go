@@ -1,7 +1,8 @@
 package registry
 
 import (
-	"log"
+	"GbankRPC/logging"
+	"GbankRPC/metrics"
 	"net/http"
 	"sort"
 	"strings"
@@ -16,6 +17,10 @@ type GBankRegistry struct {
 	timeout time.Duration
 	mu      sync.Mutex
 	servers map[string]*ServerItem
+	// 收到的心跳次数及超时移除的服务实例数
+	heartbeats  uint64
+	expirations uint64
+	logger      logging.Logger
 }
 
 // ServerItem 服务实例
@@ -33,13 +38,23 @@ func NewGBankRegistry(timeout time.Duration) *GBankRegistry {
 	return &GBankRegistry{
 		timeout: timeout,
 		servers: make(map[string]*ServerItem),
+		logger:  logging.Nop(),
 	}
 }
 
+// SetLogger 设置注册中心日志，默认丢弃全部日志
+func (g *GBankRegistry) SetLogger(logger logging.Logger) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logger = logging.OrNop(logger)
+}
+
 // HandleHTTP 注册http路径
 func (g *GBankRegistry) HandleHTTP(registryPath string) {
 	http.Handle(registryPath, g)
-	log.Println("GBankRegistry registry url :", registryPath)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logger.Info("rpc registry: serving", "path", registryPath)
 }
 
 func (g *GBankRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -63,8 +78,10 @@ func (g *GBankRegistry) putServer(addr string) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	g.heartbeats++
 	s := g.servers[addr]
 	if s == nil {
+		g.logger.Info("rpc registry: server registered", "addr", addr)
 		g.servers[addr] = &ServerItem{Addr: addr, start: time.Now()}
 	} else {
 		s.start = time.Now()
@@ -77,46 +94,83 @@ func (g *GBankRegistry) getAliveServers() []string {
 	defer g.mu.Unlock()
 
 	var res []string
+	now := time.Now()
 	for addr, s := range g.servers {
-		if g.timeout == 0 || s.start.Add(g.timeout).After(time.Now()) {
+		if g.alive(s, now) {
 			res = append(res, addr)
 		} else {
 			delete(g.servers, addr)
+			g.expirations++
+			g.logger.Info("rpc registry: server expired", "addr", addr)
 		}
 	}
 	sort.Strings(res)
 	return res
 }
 
-// HeartBeat 定时心跳注册
+// 服务实例在 now 时是否存活，需持有 g.mu
+func (g *GBankRegistry) alive(s *ServerItem, now time.Time) bool {
+	return g.timeout == 0 || s.start.Add(g.timeout).After(now)
+}
+
+// HeartBeat 定时心跳注册，心跳停止时通过 logging.Default() 输出日志
 func HeartBeat(registry, serverAddr string, duration time.Duration) {
+	HeartBeatWithLogger(registry, serverAddr, duration, logging.Default())
+}
+
+// HeartBeatWithLogger 定时心跳注册，心跳过程的日志写入 logger
+func HeartBeatWithLogger(registry, serverAddr string, duration time.Duration, logger logging.Logger) {
 	if duration == 0 {
 		duration = DefaultTimeOut - time.Duration(1)*time.Minute
 	}
-	err := sendHeartBeat(registry, serverAddr)
+	logger = logging.OrNop(logger).With("registry", registry, "addr", serverAddr)
+	err := sendHeartBeat(registry, serverAddr, logger)
 
 	go func() {
 		t := time.NewTicker(duration)
 		for err == nil {
 			<-t.C
-			err = sendHeartBeat(registry, serverAddr)
+			err = sendHeartBeat(registry, serverAddr, logger)
 		}
-		log.Println("HeartBeat error: ", err)
+		logger.Error("rpc server: heart beat stopped", "err", err)
 	}()
 }
 
 // 发送心跳请求
-func sendHeartBeat(registry, serverAddr string) error {
-	log.Println(serverAddr, "send heart beat to registry", registry)
+func sendHeartBeat(registry, serverAddr string, logger logging.Logger) error {
+	logger.Debug("rpc server: send heart beat")
 	client := &http.Client{}
 	req, err := http.NewRequest("POST", registry, nil)
 	if err != nil {
-		log.Println("rpc server: POST heart beat err:", err)
+		logger.Warn("rpc server: new heart beat request error", "err", err)
+		return err
 	}
 	req.Header.Set("X-GBankRPC-server", serverAddr)
 	if _, err := client.Do(req); err != nil {
-		log.Println("rpc server: heart beat err:", err)
+		logger.Warn("rpc server: heart beat error", "err", err)
 		return err
 	}
 	return nil
 }
+
+// WriteMetrics 输出存活的服务实例数、收到的心跳次数及超时移除的服务实例数
+// 仅统计存活的实例，不移除超时的实例，超时实例在查询服务列表时移除
+func (g *GBankRegistry) WriteMetrics(w *metrics.Writer) {
+	g.mu.Lock()
+	alive := 0
+	now := time.Now()
+	for _, s := range g.servers {
+		if g.alive(s, now) {
+			alive++
+		}
+	}
+	heartbeats, expirations := g.heartbeats, g.expirations
+	g.mu.Unlock()
+
+	w.Header("gbankrpc_registry_instances", metrics.TypeGauge, "Alive server instances.")
+	w.Sample("gbankrpc_registry_instances", float64(alive))
+	w.Header("gbankrpc_registry_heartbeats_total", metrics.TypeCounter, "Heartbeats received from servers.")
+	w.Sample("gbankrpc_registry_heartbeats_total", float64(heartbeats))
+	w.Header("gbankrpc_registry_expirations_total", metrics.TypeCounter, "Server instances removed after missing heartbeats.")
+	w.Sample("gbankrpc_registry_expirations_total", float64(expirations))
+}
@@ -2,16 +2,22 @@ package GbankRPC
 
 import (
 	"GbankRPC/codec"
+	"GbankRPC/logging"
+	"GbankRPC/metrics"
+	"GbankRPC/trace"
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/ast"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,15 +31,34 @@ type Option struct {
 	CodecType codec.Type
 	// 连接超时
 	ConnectTimeout time.Duration
-	// 处理超时
+	// 处理超时，服务端设置了上限时以上限为准
 	HandleTimeout time.Duration
+	// 客户端支持的协议版本，为 0 时使用当前的 ProtocolVersion
+	ProtocolVersion int
+	// 按旧协议连接，不发送协议版本，服务端不回复握手结果，依赖握手的特性（如取消帧）不可用，
+	// 仅用于连接不支持握手的旧版本服务端
+	LegacyProtocol bool `json:"-"`
+	// DialHTTP 发送 CONNECT 请求的路径，需与服务端 WithHTTPPaths 设置的 rpcPath 一致，为空时使用默认路径
+	RPCPath string `json:"-"`
+	// 消息压缩算法，为空时不压缩
+	Compression codec.Compression
+	// 压缩阈值，编码后小于该长度的消息不压缩，为 0 时使用默认值
+	CompressThreshold int
+	// 客户端拦截器，按传入顺序依次执行，仅在本地生效
+	Interceptors []ClientInterceptor `json:"-"`
+	// 客户端 Tracer，为空时不创建客户端 span，ctx 中的链路信息仍随请求发送
+	Tracer *trace.Tracer `json:"-"`
+	// 客户端日志，为空时丢弃全部日志
+	Logger logging.Logger `json:"-"`
 }
 
 // DefaultOption 默认配置
 var DefaultOption = &Option{
-	MagicNumber:    MagicNumber,
-	CodecType:      codec.GobCodecType,
-	ConnectTimeout: 10 * time.Second,
+	MagicNumber:     MagicNumber,
+	CodecType:       codec.GobCodecType,
+	ConnectTimeout:  10 * time.Second,
+	ProtocolVersion: ProtocolVersion,
+	RPCPath:         defaultRPCPath,
 }
 
 // Request 请求
@@ -42,80 +67,618 @@ type Request struct {
 	args, reply reflect.Value
 	service     *Service
 	method      *MethodType
+	// 读取请求期间连接上读取的字节数
+	size uint64
 }
 
-// server 服务实例
-type server struct {
+// Server 服务实例
+type Server struct {
 	serviceTable sync.Map
+
+	mu sync.Mutex
+	// 关闭流程开始后不再接收新的连接
+	inShutdown bool
+	listeners  map[net.Listener]struct{}
+	conns      map[*serverConn]struct{}
+	// 全部连接上处理中的请求数
+	activeRequests int64
+	// 未找到对应方法的请求的统计
+	unknownStats methodStats
+	// 组合后的服务端拦截器
+	interceptor ServerInterceptor
+	// 服务方法或拦截器发生 panic 时的回调
+	panicHandler PanicHandler
+	// 保证注册、移除 service 的读改写过程互斥
+	registerMu sync.Mutex
+
+	// 服务端限制，为 0 时不限制
+	maxHandleTimeout      time.Duration
+	maxConns              int
+	maxConcurrentRequests int64
+	// 允许客户端使用的编解码类型，为空时允许全部已注册的类型
+	allowedCodecs map[codec.Type]struct{}
+	logger        logging.Logger
+	rpcPath       string
+	debugPath     string
+	// 是否注册内置的反射服务
+	reflection bool
+	// 是否注册内置的健康检查服务及 HTTP 健康检查路径
+	healthCheck bool
+	health      *healthService
+	healthPath  string
+	// 在 metricsPath 上与服务端指标一同输出的其他指标
+	collectors  []metrics.Collector
+	metricsPath string
+	// 为空时不创建服务端 span
+	tracer *trace.Tracer
+	// 为空时不记录访问日志
+	accessLog *AccessLogConfig
+}
+
+// ServerOption 服务端配置项
+type ServerOption func(*Server)
+
+// WithMaxHandleTimeout 设置请求处理超时的上限，客户端未设置或设置的处理超时超过上限时按上限处理
+func WithMaxHandleTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxHandleTimeout = d
+	}
+}
+
+// WithMaxConns 设置最大连接数，超出时拒绝新连接的握手
+func WithMaxConns(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConcurrentRequests 设置全部连接上同时处理的最大请求数，超出时返回 CodeResourceExhausted 错误
+func WithMaxConcurrentRequests(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConcurrentRequests = int64(n)
+	}
+}
+
+// WithAllowedCodecs 限制客户端可使用的编解码类型
+func WithAllowedCodecs(types ...codec.Type) ServerOption {
+	return func(s *Server) {
+		s.allowedCodecs = make(map[codec.Type]struct{}, len(types))
+		for _, t := range types {
+			s.allowedCodecs[t] = struct{}{}
+		}
+	}
+}
+
+// WithLogger 设置服务端日志，注册的服务共用该日志。默认为 logging.Default()，
+// 只通过标准库 log 输出方法 panic、Accept 出错等 Error 级别的日志，需丢弃全部日志时传入 logging.Nop()
+func WithLogger(logger logging.Logger) ServerOption {
+	return func(s *Server) {
+		if logger == nil {
+			logger = logging.Default()
+		}
+		s.logger = logger
+	}
+}
+
+// WithHTTPPaths 设置 HandleHTTP 注册的 rpc 及 debug 路径
+func WithHTTPPaths(rpcPath, debugPath string) ServerOption {
+	return func(s *Server) {
+		s.rpcPath = rpcPath
+		s.debugPath = debugPath
+	}
+}
+
+// WithHealth 设置是否注册内置的健康检查服务 _Health 及 HandleHTTP 的健康检查路径，默认注册
+// 关闭后 SetServingStatus 设置的状态仅可通过 ServingStatus 查询
+func WithHealth(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.healthCheck = enabled
+	}
+}
+
+// WithHealthPath 设置 HandleHTTP 注册的健康检查路径，默认为 /healthz
+func WithHealthPath(path string) ServerOption {
+	return func(s *Server) {
+		s.healthPath = path
+	}
 }
 
+// WithMetricsPath 设置 HandleHTTP 注册的 Prometheus 指标路径，默认为 /gbankrpc/metrics
+func WithMetricsPath(path string) ServerOption {
+	return func(s *Server) {
+		s.metricsPath = path
+	}
+}
+
+// WithReflection 设置是否注册内置的反射服务 _Reflection，默认不注册
+// 开启后任意客户端都可以列出全部服务及方法的参数结构，应仅在可信网络中开启
+func WithReflection(enabled bool) ServerOption {
+	return func(s *Server) {
+		s.reflection = enabled
+	}
+}
+
+// WithServerInterceptors 设置服务端拦截器，按传入顺序依次执行
+func WithServerInterceptors(interceptors ...ServerInterceptor) ServerOption {
+	return func(s *Server) {
+		s.interceptor = ChainServerInterceptors(interceptors...)
+	}
+}
+
+// WithPanicHandler 设置服务方法或拦截器发生 panic 时的回调，panic 本身总会被恢复并记录日志
+func WithPanicHandler(handler PanicHandler) ServerOption {
+	return func(s *Server) {
+		s.panicHandler = handler
+	}
+}
+
+// ErrServerClosed 服务端关闭后调用 Accept 返回的错误
+var ErrServerClosed = errors.New("rpc: server closed")
+
+// 连接数已达上限
+var errTooManyConns = errors.New("rpc: too many connections")
+
+// 关闭流程中检查处理中请求数的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
 // 无效请求回复
 var invalidResponseBody = struct{}{}
 
 // NewServer 新建server
-func NewServer() *server {
-	return &server{}
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		listeners:   make(map[net.Listener]struct{}),
+		conns:       make(map[*serverConn]struct{}),
+		logger:      logging.Default(),
+		rpcPath:     defaultRPCPath,
+		debugPath:   defaultDebugRPCPath,
+		healthCheck: true,
+		healthPath:  defaultHealthPath,
+		metricsPath: defaultMetricsPath,
+	}
+	s.health = newHealthService(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.reflection {
+		s.RegisterName(ReflectionServiceName, &reflectionService{s: s})
+	}
+	if s.healthCheck {
+		s.RegisterName(HealthServiceName, s.health)
+	}
+	return s
 }
 
 // Accept 接收每一个连接请求，并进行处理
-func (s *server) Accept(ls net.Listener) {
+func (s *Server) Accept(ls net.Listener) {
+	if !s.trackListener(ls) {
+		ls.Close()
+		return
+	}
+	defer s.untrackListener(ls)
+
 	for {
 		conn, err := ls.Accept()
 		if err != nil {
-			log.Println("server accept error", err)
+			if !s.shuttingDown() {
+				s.logger.Error("rpc server: accept error", "err", err)
+			}
 			return
 		}
 		go s.ServeConn(conn)
 	}
 }
 
+// Shutdown 优雅关闭服务端：停止接收新连接，通知客户端不再发送新请求，等待处理中的请求完成后关闭全部连接。
+// ctx 到期时强制关闭全部连接并返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.setShutdown()
+	s.mu.Lock()
+	s.inShutdown = true
+	err := s.closeListenersLocked()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.mu.Unlock()
+
+	// 对端不读取数据时发送关闭通知会一直阻塞，在单独的 goroutine 中发送，ctx 到期时关闭连接使其返回
+	var wg sync.WaitGroup
+	for _, sc := range conns {
+		if lastSeq, ok := sc.goAway(); ok {
+			wg.Add(1)
+			go func(sc *serverConn, lastSeq uint64) {
+				defer wg.Done()
+				sc.sendGoAway(lastSeq)
+			}(sc, lastSeq)
+		}
+	}
+	sent := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(sent)
+	}()
+
+	// 等待关闭通知全部发出且处理中的请求完成，避免客户端在收到通知前连接已被关闭
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-sent:
+			sent = nil
+		case <-ticker.C:
+		}
+		if sent == nil && atomic.LoadInt64(&s.activeRequests) == 0 {
+			break
+		}
+	}
+
+	s.closeConns()
+	return err
+}
+
+// Close 立即关闭服务端的全部监听及连接，处理中的请求将被取消
+func (s *Server) Close() error {
+	s.health.setShutdown()
+	s.mu.Lock()
+	s.inShutdown = true
+	err := s.closeListenersLocked()
+	s.mu.Unlock()
+
+	s.closeConns()
+	return err
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+func (s *Server) trackListener(ls net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	s.listeners[ls] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackListener(ls net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, ls)
+}
+
+func (s *Server) closeListenersLocked() error {
+	var err error
+	for ls := range s.listeners {
+		if e := ls.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.listeners, ls)
+	}
+	return err
+}
+
+func (s *Server) trackConn(sc *serverConn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return ErrServerClosed
+	}
+	if s.maxConns > 0 && len(s.conns) >= s.maxConns {
+		return errTooManyConns
+	}
+	s.conns[sc] = struct{}{}
+	return nil
+}
+
+func (s *Server) untrackConn(sc *serverConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, sc)
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sc := range s.conns {
+		sc.conn.Close()
+		delete(s.conns, sc)
+	}
+}
+
 // ServeConn 处理单个连接
-func (s *server) ServeConn(conn io.ReadWriteCloser) {
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer conn.Close()
 
-	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("ServerConn error", err)
+	sc := newServerConn(conn, s.logger)
+	trackErr := s.trackConn(sc)
+	if trackErr == ErrServerClosed {
 		return
 	}
+	if trackErr == nil {
+		defer s.untrackConn(sc)
+	}
 
-	// option 字段校验
-	if opt.MagicNumber != MagicNumber {
-		log.Println("ServerConn opt.MagicNumber not MagicNumber,is ", opt.MagicNumber)
+	// option 以一行 json 发送，按行读取避免预读后续请求数据
+	var opt Option
+	br := bufio.NewReader(conn)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		sc.logger.Warn("rpc server: read option error", "err", err)
+		return
+	}
+	if err := json.Unmarshal(line, &opt); err != nil {
+		sc.logger.Warn("rpc server: decode option error", "err", err)
 		return
 	}
 
-	f := codec.NewCodecFuncTable[opt.CodecType]
-	if f == nil {
-		log.Println("ServerConn opt.CodecType not define,is ", opt.CodecType)
+	// option 字段校验，携带协议版本号的客户端需等待握手回复
+	f, hs := s.negotiate(&opt)
+	if trackErr != nil && hs.Accepted {
+		f, hs.Accepted, hs.Reason = nil, false, trackErr.Error()
+	}
+	if opt.ProtocolVersion > 0 {
+		if err := json.NewEncoder(conn).Encode(hs); err != nil {
+			sc.logger.Warn("rpc server: write handshake error", "err", err)
+			return
+		}
+	}
+	if !hs.Accepted {
+		sc.logger.Info("rpc server: handshake rejected", "reason", hs.Reason, "codec", opt.CodecType)
 		return
 	}
-	s.ServeCodec(f(conn), opt.HandleTimeout)
+
+	// 读取 option 时 br 中可能已缓存了后续请求数据，编解码器需从 br 继续读取
+	sc.counter = &countingConn{ReadWriteCloser: &bufferedConn{r: br, ReadWriteCloser: conn}}
+	sc.setCodec(f(sc.counter), &opt)
+	s.serveConn(sc, s.handleTimeout(opt.HandleTimeout))
+}
+
+// 按服务端限制调整客户端设置的处理超时
+func (s *Server) handleTimeout(timeout time.Duration) time.Duration {
+	if s.maxHandleTimeout > 0 && (timeout <= 0 || timeout > s.maxHandleTimeout) {
+		return s.maxHandleTimeout
+	}
+	return timeout
+}
+
+// bufferedConn 从带缓冲的 reader 读取数据，写入及关闭直接作用于原连接
+type bufferedConn struct {
+	r *bufio.Reader
+	io.ReadWriteCloser
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// serverConn 单个连接的处理状态
+type serverConn struct {
+	conn    io.Closer
+	cc      codec.Codec
+	sending sync.Mutex
+	wg      sync.WaitGroup
+	// 连接断开后取消该连接上全部处理中的请求
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	// 处理中的请求，收到客户端取消帧时取消对应请求
+	inflight map[uint64]*inflightRequest
+	// 已开始关闭流程，不再接收新请求
+	goingAway bool
+	// 客户端协商的协议版本，旧协议及通过 ServeCodec 处理的连接为 0
+	protocolVersion int
+	// 最后一个已接收请求的序号，随关闭通知发给客户端，
+	// 客户端据此判断哪些已发出的请求未被服务端接收
+	lastSeq uint64
+	// 统计读写字节数，通过 ServeCodec 处理的连接为空
+	counter *countingConn
+
+	// 供 debug 页面展示的连接信息
+	remoteAddr  string
+	start       time.Time
+	codecType   codec.Type
+	compression codec.Compression
+	// 附加了连接信息的日志
+	logger logging.Logger
+}
+
+// 处理中的请求
+type inflightRequest struct {
+	serviceMethod string
+	start         time.Time
+	cancel        context.CancelFunc
+}
+
+func newServerConn(conn io.Closer, logger logging.Logger) *serverConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := &serverConn{
+		conn:     conn,
+		ctx:      ctx,
+		cancel:   cancel,
+		inflight: make(map[uint64]*inflightRequest),
+		start:    time.Now(),
+		logger:   logger,
+	}
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		sc.remoteAddr = c.RemoteAddr().String()
+		sc.logger = logger.With("remote", sc.remoteAddr)
+	}
+	return sc
+}
+
+// 握手完成后设置编解码器，握手期间已开始关闭流程时补发关闭通知
+// opt 为客户端协商的 option，通过 ServeCodec 处理的连接为空
+func (sc *serverConn) setCodec(cc codec.Codec, opt *Option) {
+	sc.mu.Lock()
+	sc.cc = cc
+	if opt != nil {
+		sc.codecType, sc.compression = opt.CodecType, opt.Compression
+		sc.protocolVersion = opt.ProtocolVersion
+	}
+	goingAway, lastSeq := sc.goingAway && sc.supportsGoAway(), sc.lastSeq
+	sc.mu.Unlock()
+
+	if goingAway {
+		sc.sendGoAway(lastSeq)
+	}
+}
+
+// 标记连接即将关闭，此后连接上读到的请求一律拒绝，lastSeq 之前的请求均已计入 activeRequests。
+// ok 为 true 时需向客户端发送携带 lastSeq 的关闭通知
+func (sc *serverConn) goAway() (lastSeq uint64, ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.goingAway {
+		return 0, false
+	}
+	sc.goingAway = true
+	return sc.lastSeq, sc.cc != nil && sc.supportsGoAway()
+}
+
+// 只有握手时得知 FeatureGoAway 的客户端能识别关闭通知，
+// 旧协议及 ServeCodec 的客户端会将其当作响应处理，不发送。需持有 sc.mu
+func (sc *serverConn) supportsGoAway() bool {
+	return sc.protocolVersion >= 1
+}
+
+// 发送关闭通知，Seq 为最后一个已接收请求的序号
+func (sc *serverConn) sendGoAway(lastSeq uint64) {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+
+	if err := sc.cc.Write(&codec.Header{Seq: lastSeq, Control: codec.ControlGoAway}, invalidResponseBody); err != nil {
+		sc.logger.Warn("rpc server: write go away error", "err", err)
+	}
+}
+
+// 记录处理中的请求
+func (sc *serverConn) track(seq uint64, serviceMethod string, cancel context.CancelFunc) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.inflight[seq] = &inflightRequest{serviceMethod: serviceMethod, start: time.Now(), cancel: cancel}
+}
+
+// 移除处理中的请求
+func (sc *serverConn) untrack(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.inflight, seq)
+}
+
+// 取消处理中的请求
+func (sc *serverConn) cancelRequest(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if r, ok := sc.inflight[seq]; ok {
+		r.cancel()
+	}
 }
 
 // ServeCodec 根据编解码类型的不同读取连接数据并进行逻辑处理
-func (s *server) ServeCodec(cc codec.Codec, timeout time.Duration) {
-	sending := new(sync.Mutex)
-	wg := new(sync.WaitGroup)
+func (s *Server) ServeCodec(cc codec.Codec, timeout time.Duration) {
+	defer cc.Close()
+
+	sc := newServerConn(cc, s.logger)
+	if s.trackConn(sc) != nil {
+		return
+	}
+	defer s.untrackConn(sc)
+
+	sc.setCodec(cc, nil)
+	s.serveConn(sc, s.handleTimeout(timeout))
+}
+
+// 循环读取连接上的请求并处理
+func (s *Server) serveConn(sc *serverConn, timeout time.Duration) {
+	defer func() {
+		sc.cancel()
+		sc.wg.Wait()
+	}()
 
 	for {
 		// 读取 request
-		req, err := s.readRequest(cc)
+		read := sc.counter.bytesRead()
+		req, err := s.readRequest(sc)
+		if req != nil {
+			req.size = sc.counter.bytesRead() - read
+		}
 		if err != nil {
 			// 读取 request 过程中出现错误，直接返回
 			if req == nil {
 				break
 			}
-			req.h.Err = err.Error()
-			s.sendResponse(cc, &req.h, invalidResponseBody, sending)
+			s.rejectRequest(sc, req, err)
+			continue
+		}
+
+		switch req.h.Control {
+		case codec.ControlNone:
+			n, ok := s.acceptRequest(sc, req.h.Seq)
+			if !ok {
+				// 客户端发出请求时尚未收到关闭通知，按 lastSeq 判断后已自行以 ErrGoAway 结束该请求
+				s.rejectRequest(sc, req, ErrGoAway)
+				continue
+			}
+			if s.maxConcurrentRequests > 0 && n > s.maxConcurrentRequests {
+				atomic.AddInt64(&s.activeRequests, -1)
+				s.rejectRequest(sc, req, Errorf(CodeResourceExhausted,
+					"rpc server: too many concurrent requests, limit %d", s.maxConcurrentRequests))
+				continue
+			}
+			sc.wg.Add(1)
+			go s.handleRequest(sc, req, timeout)
+		case codec.ControlCancel:
+			sc.cancelRequest(req.h.Seq)
 		}
-		wg.Add(1)
-		go s.handleRequest(cc, sending, wg, req, timeout)
 	}
 }
 
+// 回复在 serveConn 中被拒绝、未进入 handleRequest 的请求并记入统计、链路及访问日志，
+// 未找到对应方法时记入 UnknownServiceMethod
+func (s *Server) rejectRequest(sc *serverConn, req *Request, err error) {
+	start := time.Now()
+	_, span := s.startSpan(sc.ctx, sc, req)
+	defer endSpan(span, err)
+
+	header, incoming := req.h, req.h.Metadata
+	setHeaderError(&req.h, err)
+	req.h.Metadata = nil
+	written := s.sendResponse(sc, &req.h, invalidResponseBody)
+
+	code := ErrorCode(err)
+	stats := &s.unknownStats
+	if req.method != nil {
+		stats = &req.method.stats
+	}
+	stats.record(code, err.Error(), time.Since(start), false, req.size, written)
+	s.writeAccessLog(sc, &header, incoming, start, code, req.size, written)
+}
+
+// 接收请求并计入 activeRequests，返回计入后的处理中请求数
+// 已发出关闭通知时拒绝接收，与 goAway 在同一把锁下保证关闭通知中的 lastSeq 准确
+func (s *Server) acceptRequest(sc *serverConn, seq uint64) (int64, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.goingAway {
+		return 0, false
+	}
+	sc.lastSeq = seq
+	return atomic.AddInt64(&s.activeRequests, 1), true
+}
+
 // 读取请求信息
-func (s *server) readRequest(cc codec.Codec) (*Request, error) {
+func (s *Server) readRequest(sc *serverConn) (*Request, error) {
+	cc := sc.cc
 	// 读取header
 	var h codec.Header
 	if err := cc.ReadHeader(&h); err != nil {
@@ -123,9 +686,18 @@ func (s *server) readRequest(cc codec.Codec) (*Request, error) {
 	}
 
 	req := &Request{h: h}
+	// 控制帧没有有效的 body
+	if h.Control != codec.ControlNone {
+		return req, cc.ReadBody(nil)
+	}
+
 	service, method, err := s.findServiceMethod(req.h.ServiceMethod)
 	if err != nil {
-		return nil, err
+		// 丢弃 body 后返回错误，由调用方回复客户端，连接可继续使用
+		if bodyErr := cc.ReadBody(nil); bodyErr != nil {
+			return nil, bodyErr
+		}
+		return req, err
 	}
 	req.service = service
 	req.method = method
@@ -140,96 +712,260 @@ func (s *server) readRequest(cc codec.Codec) (*Request, error) {
 		argsi = req.args.Addr().Interface()
 	}
 	if err := cc.ReadBody(argsi); err != nil {
-		log.Println("readRequest read body error.err = ", err)
+		sc.logger.Warn("rpc server: read body error", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+		return req, Errorf(CodeInvalidArgument, "readRequest rpc server: read body error: %s", err)
 	}
 	return req, nil
 }
 
-// 处理请求
-func (s *server) handleRequest(cc codec.Codec, sending *sync.Mutex, wg *sync.WaitGroup, req *Request,
-	timeout time.Duration) {
-	defer wg.Done()
+// 处理请求，超时、客户端取消或连接断开时取消传给方法的 ctx
+// 客户端携带剩余超时时间时，以其与 timeout 中较早到期的为准
+func (s *Server) handleRequest(sc *serverConn, req *Request, timeout time.Duration) {
+	defer sc.wg.Done()
+	defer atomic.AddInt64(&s.activeRequests, -1)
+
+	// 统计处理结果，连接断开或客户端取消时不回复，按 CodeCanceled 统计
+	start := time.Now()
+	stats := &req.method.stats
+	atomic.AddInt64(&stats.inFlight, 1)
+	code, timedOut, written := CodeCanceled, false, uint64(0)
+	errMsg := "rpc server: request canceled"
+	var span *trace.Span
+	// 处理过程中 req.h.Metadata 会被替换为响应元数据
+	header, incoming := req.h, req.h.Metadata
+	defer func() {
+		atomic.AddInt64(&stats.inFlight, -1)
+		stats.record(code, errMsg, time.Since(start), timedOut, req.size, written)
+		s.writeAccessLog(sc, &header, incoming, start, code, req.size, written)
+		if span != nil {
+			span.SetStatus(code.String(), errMsg)
+			span.End()
+		}
+	}()
+
+	var deadline time.Time
+	fromClient := false
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if req.h.Timeout > 0 {
+		if d := time.Now().Add(req.h.Timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+			fromClient = true
+		}
+	}
+	req.h.Timeout = 0
+
+	ctx, cancel := context.WithCancel(sc.ctx)
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(sc.ctx, deadline)
+	}
+	defer cancel()
+
+	sc.track(req.h.Seq, req.h.ServiceMethod, cancel)
+	defer sc.untrack(req.h.Seq)
 
 	called := make(chan struct{})
 	sent := make(chan struct{})
+	// 由处理请求的 goroutine 写入，sent 之后读取
+	var callCode Code
+	var callWritten uint64
 
 	// 防止超时后goroutine泄漏
 	finish := make(chan struct{})
 	defer close(finish)
 
+	ctx, span = s.startSpan(ctx, sc, req)
+	// 请求元数据通过 ctx 交给方法，响应头中只携带方法设置的响应元数据
+	ctx, md := newServerMetadataContext(ctx, req.h.Metadata)
+	h := req.h
+	req.h.Metadata = nil
+
 	go func() {
-		err := req.service.Call(req.method, req.args, req.reply)
+		err := s.invoke(ctx, req, h)
 		select {
 		case <-finish:
 			close(called)
 			close(sent)
 			return
 		case called <- struct{}{}:
+			req.h.Metadata = md.replyMetadata()
 			if err != nil {
-				req.h.Err = err.Error()
-				s.sendResponse(cc, &req.h, invalidResponseBody, sending)
+				setHeaderError(&req.h, err)
+				callCode = Code(req.h.ErrCode)
+				callWritten = s.sendResponse(sc, &req.h, invalidResponseBody)
 				sent <- struct{}{}
 				return
 			}
-			s.sendResponse(cc, &req.h, req.reply.Interface(), sending)
+			callWritten = s.sendResponse(sc, &req.h, req.reply.Interface())
+			callCode = Code(req.h.ErrCode)
 			sent <- struct{}{}
 		}
 	}()
 
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
-	}
-
 	select {
-	case <-time.After(timeout):
-		req.h.Err = fmt.Sprintf("rpc server: request handle timeout:except %d", timeout)
-		s.sendResponse(cc, &req.h, invalidResponseBody, sending)
+	case <-ctx.Done():
+		// 连接已断开或客户端已取消时无需回复
+		if sc.ctx.Err() != nil || ctx.Err() == context.Canceled {
+			return
+		}
+		if fromClient {
+			setHeaderError(&req.h, NewError(CodeDeadlineExceeded, "rpc server: client deadline exceeded"))
+		} else {
+			setHeaderError(&req.h, Errorf(CodeDeadlineExceeded, "rpc server: request handle timeout:except %s", timeout))
+		}
+		code, timedOut, errMsg = CodeDeadlineExceeded, true, req.h.Err
+		written = s.sendResponse(sc, &req.h, invalidResponseBody)
 	case <-called:
 		<-sent
+		code, written, errMsg = callCode, callWritten, req.h.Err
 	}
 }
 
-// 回复处理结果
-func (s *server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
-	sending.Lock()
-	defer sending.Unlock()
-
-	if err := cc.Write(h, body); err != nil {
-		log.Println("sendResponse write err", err)
+// 回复处理结果，返回写入连接的字节数
+// 回复超出编解码器的帧长度限制时，改为向该请求回复 CodeResourceExhausted 错误并写入 h，连接上的其他请求不受影响
+func (s *Server) sendResponse(sc *serverConn, h *codec.Header, body interface{}) uint64 {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+
+	written := sc.counter.bytesWritten()
+	err := sc.cc.Write(h, body)
+	if errors.Is(err, codec.ErrFrameTooLarge) {
+		sc.logger.Warn("rpc server: response too large", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+		h.Metadata = nil
+		setHeaderError(h, Errorf(CodeResourceExhausted, "rpc server: response too large: %s", err))
+		err = sc.cc.Write(h, invalidResponseBody)
+	}
+	if err != nil {
+		sc.logger.Warn("rpc server: write response error", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
 	}
+	return sc.counter.bytesWritten() - written
 }
 
 // RegisterService 通过传入的 obj 注册service
-func (s *server) RegisterService(obj interface{}) error {
-	service := NewService(obj)
+func (s *Server) RegisterService(obj interface{}) error {
+	return s.register(newTypeService(obj, s.logger))
+}
+
+// RegisterName 以指定名称注册service，名称可使用 "." 分隔的命名空间，如 bank.v2.Account
+func (s *Server) RegisterName(name string, obj interface{}) error {
+	if err := validServiceName(name); err != nil {
+		return err
+	}
+	return s.register(newService(name, obj, s.logger))
+}
+
+// RegisterFunc 将普通函数注册为 serviceMethod，签名需为 func(Arg, *Reply) error 或
+// func(context.Context, Arg, *Reply) error，同一 service 下可注册多个函数
+func (s *Server) RegisterFunc(serviceMethod string, fn interface{}) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return errors.New("RegisterFunc rpc: service/Method ill-formed: " + serviceMethod)
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	if err := validServiceName(serviceName); err != nil {
+		return err
+	}
+	if !ast.IsExported(methodName) {
+		return errors.New("RegisterFunc rpc: Method name should be exported: " + methodName)
+	}
+
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return errors.New("RegisterFunc rpc: fn should be a func: " + serviceMethod)
+	}
+	method, err := newMethodType(reflect.Method{Name: methodName, Type: fv.Type(), Func: fv}, 0)
+	if err != nil {
+		return errors.New("RegisterFunc rpc: " + err.Error())
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	// 已注册的 service 可能正在被并发读取，复制后整体替换
+	svc := &Service{name: serviceName, methods: make(map[string]*MethodType)}
+	if old, ok := s.serviceTable.Load(serviceName); ok {
+		oldSvc := old.(*Service)
+		if !oldSvc.funcs {
+			return errors.New("RegisterFunc rpc: service already defined: " + serviceName)
+		}
+		if _, ok := oldSvc.methods[methodName]; ok {
+			return errors.New("RegisterFunc rpc: Method already defined: " + serviceMethod)
+		}
+		for name, m := range oldSvc.methods {
+			svc.methods[name] = m
+		}
+	}
+	svc.methods[methodName] = method
+	svc.funcs = true
+	svc.panicHandler = s.panicHandler
+	svc.logger = s.logger
+	s.serviceTable.Store(serviceName, svc)
+	return nil
+}
+
+// Unregister 移除已注册的service，处理中的请求不受影响
+// 内置的 _Health 与 _Reflection 服务需通过 WithHealth、WithReflection 关闭，不能移除
+func (s *Server) Unregister(name string) error {
+	if name == HealthServiceName || name == ReflectionServiceName {
+		return errors.New("Unregister rpc: can't unregister built-in service " + name)
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if _, ok := s.serviceTable.LoadAndDelete(name); !ok {
+		return errors.New("Unregister rpc: can't find service " + name)
+	}
+	return nil
+}
+
+func (s *Server) register(service *Service) error {
+	service.panicHandler = s.panicHandler
+	service.logger = s.logger
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
 	if _, ok := s.serviceTable.LoadOrStore(service.name, service); ok {
 		return errors.New("RegisterService rpc: service already defined: " + service.name)
 	}
+	return nil
+}
 
+// 校验 service 名称，"." 分隔的每一段均不能为空
+func validServiceName(name string) error {
+	if name == "" {
+		return errors.New("rpc: service name is empty")
+	}
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || strings.ContainsAny(part, " \t\r\n") {
+			return errors.New("rpc: service name is not valid: " + name)
+		}
+	}
 	return nil
 }
 
-// 查找对应的service及method exp:service.Method
-func (s *server) findServiceMethod(serviceMethod string) (*Service, *MethodType, error) {
-	parts := strings.Split(serviceMethod, ".")
-	if len(parts) != 2 {
-		return nil, nil, errors.New("findServiceMethod rpc server: service/Method request ill-formed: " + serviceMethod)
+// 查找对应的service及method exp:service.Method，service 名称可包含 "."，以最后一个 "." 分隔
+func (s *Server) findServiceMethod(serviceMethod string) (*Service, *MethodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 || dot == len(serviceMethod)-1 {
+		return nil, nil, NewError(CodeInvalidArgument,
+			"findServiceMethod rpc server: service/Method request ill-formed: "+serviceMethod)
 	}
 
-	serviceName := parts[0]
-	methodName := parts[1]
+	serviceName := serviceMethod[:dot]
+	methodName := serviceMethod[dot+1:]
 
 	service, ok := s.serviceTable.Load(serviceName)
 	if !ok {
-		return nil, nil, errors.New("findServiceMethod rpc server: can't find service " + serviceName)
+		return nil, nil, NewError(CodeNotFound, "findServiceMethod rpc server: can't find service "+serviceName)
 	}
 
 	svc := service.(*Service)
 	method, ok := svc.methods[methodName]
 	if !ok {
-		return nil, nil, errors.New("findServiceMethod rpc server: can't find Method " + methodName)
+		return nil, nil, NewError(CodeNotFound, "findServiceMethod rpc server: can't find Method "+methodName)
 	}
 
 	return svc, method, nil
@@ -238,10 +974,12 @@ func (s *server) findServiceMethod(serviceMethod string) (*Service, *MethodType,
 const (
 	defaultRPCPath      = "/gbankrpc/"
 	defaultDebugRPCPath = "/gbankrpc/debug"
+	defaultHealthPath   = "/healthz"
+	defaultMetricsPath  = "/gbankrpc/metrics"
 	connected           = "200 Connected to Gbank RPC"
 )
 
-func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "CONNECT" {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -259,7 +997,15 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 // HandleHTTP 注册支持的 http url
-func (s *server) HandleHTTP() {
-	http.Handle(defaultRPCPath, s)
-	http.Handle(defaultDebugRPCPath, &debugServer{s})
+func (s *Server) HandleHTTP() {
+	http.Handle(s.rpcPath, s)
+	debug := &debugServer{s}
+	http.Handle(s.debugPath, debug)
+	if !strings.HasSuffix(s.debugPath, "/") {
+		http.Handle(s.debugPath+"/", debug)
+	}
+	if s.healthCheck {
+		http.Handle(s.healthPath, &healthHandler{s})
+	}
+	http.Handle(s.metricsPath, metrics.Handler(s))
 }
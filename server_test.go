@@ -0,0 +1,524 @@
+package GbankRPC
+
+import (
+	"GbankRPC/codec"
+	"GbankRPC/logging"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Waiter 的方法阻塞直到 ctx 被取消，并将取消原因写入 done
+type Waiter struct {
+	done chan error
+}
+
+func (w *Waiter) Wait(ctx context.Context, args int, reply *int) error {
+	<-ctx.Done()
+	w.done <- ctx.Err()
+	return ctx.Err()
+}
+
+// Deadline 返回 ctx 是否携带截止时间
+func (w *Waiter) Deadline(ctx context.Context, args int, reply *bool) error {
+	_, *reply = ctx.Deadline()
+	return nil
+}
+
+func startWaiterServer(t *testing.T, opts ...ServerOption) (*Waiter, string) {
+	w := &Waiter{done: make(chan error, 1)}
+	s := NewServer(opts...)
+	_assert(s.RegisterService(w) == nil, "failed to register Waiter")
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	go s.Accept(ls)
+	return w, ls.Addr().String()
+}
+
+func expectCanceled(t *testing.T, w *Waiter) error {
+	t.Helper()
+	select {
+	case err := <-w.done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("method context was not cancelled")
+		return nil
+	}
+}
+
+func TestServer_ContextCancel(t *testing.T) {
+	t.Run("handle timeout", func(t *testing.T) {
+		w, addr := startWaiterServer(t)
+		client, err := Dial("tcp", addr, &Option{HandleTimeout: 50 * time.Millisecond})
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		var reply int
+		err = client.Call(context.Background(), "Waiter.Wait", 1, &reply)
+		_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+		_assert(expectCanceled(t, w) == context.DeadlineExceeded, "expect deadline exceeded in method")
+	})
+	t.Run("connection closed", func(t *testing.T) {
+		w, addr := startWaiterServer(t)
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+
+		call := client.Go("Waiter.Wait", 1, new(int), nil)
+		time.Sleep(50 * time.Millisecond)
+		client.Close()
+		_assert(expectCanceled(t, w) == context.Canceled, "expect canceled in method")
+		<-call.Done
+	})
+	t.Run("client cancel", func(t *testing.T) {
+		w, addr := startWaiterServer(t)
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err = client.Call(ctx, "Waiter.Wait", 1, new(int))
+		_assert(ErrorCode(err) == CodeCanceled, "expect Canceled, got %v", err)
+		_assert(expectCanceled(t, w) == context.Canceled, "expect canceled in method")
+	})
+	t.Run("client deadline", func(t *testing.T) {
+		_, addr := startWaiterServer(t)
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		var hasDeadline bool
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = client.Call(ctx, "Waiter.Deadline", 1, &hasDeadline)
+		_assert(err == nil && hasDeadline, "expect propagated deadline, err %v", err)
+
+		err = client.Call(context.Background(), "Waiter.Deadline", 1, &hasDeadline)
+		_assert(err == nil && !hasDeadline, "expect no deadline, err %v", err)
+	})
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	t.Run("drain", func(t *testing.T) {
+		s := NewServer()
+		_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+		ls, _ := net.Listen("tcp", "127.0.0.1:0")
+		accepting := make(chan struct{})
+		go func() {
+			s.Accept(ls)
+			close(accepting)
+		}()
+
+		client, err := Dial("tcp", ls.Addr().String(), nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		slow := client.Go("Account.Slow", 200, new(int), nil)
+		time.Sleep(50 * time.Millisecond)
+
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			shutdown <- s.Shutdown(ctx)
+		}()
+
+		// 收到关闭通知后客户端不再可用，也不再发送新请求
+		for i := 0; i < 100 && client.IsAvailable(); i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+		_assert(!client.IsAvailable(), "client should be unavailable after go away")
+		err = client.Call(context.Background(), "Account.Withdraw", 1, new(int))
+		_assert(err == ErrGoAway, "expect ErrGoAway, got %v", err)
+
+		call := <-slow.Done
+		_assert(call.Err == nil, "in-flight call should complete, got %v", call.Err)
+		_assert(<-shutdown == nil, "shutdown should succeed")
+		<-accepting
+
+		_, err = Dial("tcp", ls.Addr().String(), nil)
+		_assert(err != nil, "dial after shutdown should fail")
+	})
+	t.Run("race window", func(t *testing.T) {
+		// 客户端收到关闭通知前发出的请求：服务端已接收的正常完成，未接收的以 ErrGoAway 拒绝
+		s := NewServer()
+		_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+		cc := pipeCodec(s, nil)
+		defer cc.Close()
+		headers := readHeaders(cc)
+
+		err := cc.Write(&codec.Header{ServiceMethod: "Account.Slow", Seq: 1}, 200)
+		_assert(err == nil, "write request failed: %v", err)
+		waitActiveRequests(s, 1)
+
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			shutdown <- s.Shutdown(ctx)
+		}()
+
+		h := <-headers
+		_assert(h.Control == codec.ControlGoAway && h.Seq == 1, "expect go away with last seq 1, got %+v", h)
+		// 模拟客户端收到关闭通知前已发出的请求
+		err = cc.Write(&codec.Header{ServiceMethod: "Account.Slow", Seq: 2}, 1)
+		_assert(err == nil, "write request failed: %v", err)
+
+		h = <-headers
+		_assert(h.Seq == 2 && ErrorCode(headerError(&h)) == CodeUnavailable, "expect Unavailable for seq 2, got %+v", h)
+		h = <-headers
+		_assert(h.Seq == 1 && h.Err == "", "accepted call should complete, got %+v", h)
+		_assert(<-shutdown == nil, "shutdown should succeed")
+	})
+	t.Run("no go away for legacy clients", func(t *testing.T) {
+		// 不认识控制帧的客户端会将关闭通知当作响应，只应收到请求的回复
+		for name, serve := range map[string]func(s *Server) codec.Codec{
+			"legacy protocol": func(s *Server) codec.Codec { return pipeCodec(s, &Option{LegacyProtocol: true}) },
+			"serve codec": func(s *Server) codec.Codec {
+				c1, c2 := net.Pipe()
+				go s.ServeCodec(codec.NewGobCodec(c1), 0)
+				return codec.NewGobCodec(c2)
+			},
+		} {
+			s := NewServer()
+			_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+			cc := serve(s)
+			headers := readHeaders(cc)
+
+			err := cc.Write(&codec.Header{ServiceMethod: "Account.Slow", Seq: 1}, 100)
+			_assert(err == nil, "%s: write request failed: %v", name, err)
+			waitActiveRequests(s, 1)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err = s.Shutdown(ctx)
+			cancel()
+			_assert(err == nil, "%s: shutdown failed: %v", name, err)
+			h := <-headers
+			_assert(h.Control == codec.ControlNone && h.Seq == 1 && h.Err == "", "%s: unexpected header %+v", name, h)
+			cc.Close()
+		}
+	})
+	t.Run("peer not reading", func(t *testing.T) {
+		// 对端不读取回复时发送关闭通知会阻塞，Shutdown 仍应在 ctx 到期时强制关闭
+		s := NewServer()
+		_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+		cc := pipeCodec(s, nil)
+		defer cc.Close()
+
+		err := cc.Write(&codec.Header{ServiceMethod: "Account.Withdraw", Seq: 1}, 1)
+		_assert(err == nil, "write request failed: %v", err)
+		waitActiveRequests(s, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = s.Shutdown(ctx)
+		_assert(err == context.DeadlineExceeded, "expect deadline exceeded, got %v", err)
+		_assert(time.Since(start) < time.Second, "shutdown blocked for %s", time.Since(start))
+	})
+	t.Run("client fails unaccepted calls", func(t *testing.T) {
+		c1, c2 := net.Pipe()
+		defer c2.Close()
+		// 模拟只接收了第一个请求就开始关闭的服务端
+		replied := make(chan error, 1)
+		go func() {
+			br := bufio.NewReader(c2)
+			if _, err := br.ReadBytes('\n'); err != nil {
+				replied <- err
+				return
+			}
+			cc := codec.NewGobCodec(&bufferedConn{r: br, ReadWriteCloser: c2})
+			for i := 0; i < 2; i++ {
+				var h codec.Header
+				if err := cc.ReadHeader(&h); err != nil {
+					replied <- err
+					return
+				}
+				cc.ReadBody(nil)
+			}
+			if err := cc.Write(&codec.Header{Seq: 1, Control: codec.ControlGoAway}, invalidResponseBody); err != nil {
+				replied <- err
+				return
+			}
+			replied <- cc.Write(&codec.Header{Seq: 1}, 1)
+		}()
+
+		client, err := NewClient(c1, &Option{CodecType: codec.GobCodecType, LegacyProtocol: true})
+		_assert(err == nil, "new client failed: %v", err)
+		defer client.Close()
+
+		accepted := client.Go("Account.Slow", 1, new(int), nil)
+		unaccepted := client.Go("Account.Slow", 1, new(int), nil)
+		_assert(accepted.Seq == 1, "unexpected seq %d", accepted.Seq)
+
+		call := <-unaccepted.Done
+		_assert(call.Err == ErrGoAway, "expect ErrGoAway, got %v", call.Err)
+		call = <-accepted.Done
+		_assert(call.Err == nil, "accepted call should complete, got %v", call.Err)
+		_assert(<-replied == nil, "fake server failed")
+	})
+	t.Run("force close on deadline", func(t *testing.T) {
+		s := NewServer()
+		w := &Waiter{done: make(chan error, 1)}
+		_assert(s.RegisterService(w) == nil, "failed to register Waiter")
+		ls, _ := net.Listen("tcp", "127.0.0.1:0")
+		go s.Accept(ls)
+
+		client, err := Dial("tcp", ls.Addr().String(), nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		call := client.Go("Waiter.Wait", 1, new(int), nil)
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err = s.Shutdown(ctx)
+		_assert(err == context.DeadlineExceeded, "expect deadline exceeded, got %v", err)
+		_assert(expectCanceled(t, w) == context.Canceled, "expect canceled in method")
+		_assert((<-call.Done).Err != nil, "in-flight call should fail after force close")
+	})
+	t.Run("close", func(t *testing.T) {
+		s := NewServer()
+		w := &Waiter{done: make(chan error, 1)}
+		_assert(s.RegisterService(w) == nil, "failed to register Waiter")
+		ls, _ := net.Listen("tcp", "127.0.0.1:0")
+		go s.Accept(ls)
+
+		client, err := Dial("tcp", ls.Addr().String(), nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		call := client.Go("Waiter.Wait", 1, new(int), nil)
+		time.Sleep(50 * time.Millisecond)
+		_assert(s.Close() == nil, "close failed")
+		_assert(expectCanceled(t, w) == context.Canceled, "expect canceled in method")
+		_assert((<-call.Done).Err != nil, "in-flight call should fail after close")
+	})
+}
+
+// 通过 net.Pipe 连接 s 并完成握手，返回客户端一侧的 gob 编解码器
+func pipeCodec(s *Server, opt *Option) codec.Codec {
+	c1, c2 := net.Pipe()
+	go s.ServeConn(c1)
+	opt = parseOption(opt)
+	_assert(json.NewEncoder(c2).Encode(opt) == nil, "write option failed")
+	br := bufio.NewReader(c2)
+	if opt.ProtocolVersion > 0 {
+		_, err := br.ReadBytes('\n')
+		_assert(err == nil, "read handshake failed: %v", err)
+	}
+	return codec.NewGobCodec(&bufferedConn{r: br, ReadWriteCloser: c2})
+}
+
+// 持续读取 cc 上的响应头，连接关闭时关闭返回的 channel
+func readHeaders(cc codec.Codec) <-chan codec.Header {
+	headers := make(chan codec.Header, 8)
+	go func() {
+		defer close(headers)
+		for {
+			var h codec.Header
+			if cc.ReadHeader(&h) != nil || cc.ReadBody(nil) != nil {
+				return
+			}
+			headers <- h
+		}
+	}()
+	return headers
+}
+
+// 等待服务端处理中的请求数达到 n
+func waitActiveRequests(s *Server, n int64) {
+	for i := 0; i < 200 && atomic.LoadInt64(&s.activeRequests) < n; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_assert(atomic.LoadInt64(&s.activeRequests) >= n, "expect %d active requests", n)
+}
+
+func TestServer_Options(t *testing.T) {
+	t.Run("max handle timeout", func(t *testing.T) {
+		w, addr := startWaiterServer(t, WithMaxHandleTimeout(50*time.Millisecond))
+		// 客户端未设置处理超时，按服务端上限处理
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		err = client.Call(context.Background(), "Waiter.Wait", 1, new(int))
+		_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+		_assert(expectCanceled(t, w) == context.DeadlineExceeded, "expect deadline exceeded in method")
+	})
+	t.Run("max conns", func(t *testing.T) {
+		_, addr := startWaiterServer(t, WithMaxConns(1))
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+
+		_, err = Dial("tcp", addr, nil)
+		_assert(ErrorCode(err) == CodeUnavailable, "expect Unavailable, got %v", err)
+
+		// 连接关闭后可重新建立连接
+		client.Close()
+		time.Sleep(50 * time.Millisecond)
+		client, err = Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		client.Close()
+	})
+	t.Run("max concurrent requests", func(t *testing.T) {
+		w, addr := startWaiterServer(t, WithMaxConcurrentRequests(1))
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer client.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		waitDone := make(chan error, 1)
+		go func() { waitDone <- client.Call(ctx, "Waiter.Wait", 1, new(int)) }()
+		time.Sleep(50 * time.Millisecond)
+		var hasDeadline bool
+		err = client.Call(context.Background(), "Waiter.Deadline", 1, &hasDeadline)
+		_assert(ErrorCode(err) == CodeResourceExhausted, "expect ResourceExhausted, got %v", err)
+
+		cancel()
+		<-waitDone
+		expectCanceled(t, w)
+		time.Sleep(50 * time.Millisecond)
+		err = client.Call(context.Background(), "Waiter.Deadline", 1, &hasDeadline)
+		_assert(err == nil, "expect success after the request finished, got %v", err)
+	})
+	t.Run("allowed codecs", func(t *testing.T) {
+		_, addr := startWaiterServer(t, WithAllowedCodecs(codec.GobCodecType))
+		_, err := Dial("tcp", addr, &Option{CodecType: codec.JsonCodecType})
+		_assert(ErrorCode(err) == CodeUnavailable, "expect Unavailable, got %v", err)
+
+		client, err := Dial("tcp", addr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		_assert(len(client.Handshake().Codecs) == 1, "expect only gob advertised, got %v", client.Handshake().Codecs)
+		client.Close()
+	})
+	t.Run("logger", func(t *testing.T) {
+		buf := &lockedBuffer{}
+		_, addr := startWaiterServer(t, WithAllowedCodecs(codec.GobCodecType),
+			WithLogger(logging.NewJSON(buf, logging.LevelInfo)))
+		_, err := Dial("tcp", addr, &Option{CodecType: codec.JsonCodecType})
+		_assert(err != nil, "expect handshake rejected")
+
+		// 服务端在回复握手之后写日志
+		var entry map[string]interface{}
+		for i := 0; i < 100 && entry == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+			if line := buf.String(); line != "" {
+				_assert(json.Unmarshal([]byte(line), &entry) == nil, "invalid log line %q", line)
+			}
+		}
+		_assert(entry != nil, "expect a log entry")
+		_assert(entry["msg"] == "rpc server: handshake rejected" && entry["level"] == "INFO",
+			"unexpected log entry %v", entry)
+		_assert(entry["codec"] == string(codec.JsonCodecType) && entry["remote"] != nil,
+			"expect codec and remote fields, got %v", entry)
+	})
+}
+
+// 可并发写入的 bytes.Buffer
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServer_Register(t *testing.T) {
+	s := NewServer()
+	_assert(s.RegisterName("bank.v2.Foo", new(Foo)) == nil, "failed to register bank.v2.Foo")
+	_assert(s.RegisterService(new(Foo)) == nil, "failed to register Foo")
+	_assert(s.RegisterName("bank..Foo", new(Foo)) != nil, "expect invalid name error")
+	_assert(s.RegisterName("Foo", new(Foo)) != nil, "expect duplicate service error")
+
+	double := func(args int, reply *int) error {
+		*reply = args * 2
+		return nil
+	}
+	tenant := func(ctx context.Context, args int, reply *string) error {
+		*reply = IncomingMetadata(ctx)["tenant"]
+		return nil
+	}
+	_assert(s.RegisterFunc("math.Double", double) == nil, "failed to register math.Double")
+	_assert(s.RegisterFunc("math.Tenant", tenant) == nil, "failed to register math.Tenant")
+	_assert(s.RegisterFunc("math.Double", double) != nil, "expect duplicate method error")
+	_assert(s.RegisterFunc("Foo.Double", double) != nil, "expect error on a struct service")
+	_assert(s.RegisterFunc("math.Bad", func(args int) error { return nil }) != nil, "expect signature error")
+	_assert(s.RegisterFunc("Double", double) != nil, "expect ill-formed name error")
+
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var sum int
+	err = client.Call(context.Background(), "bank.v2.Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect 3, got %d, err %v", sum, err)
+	var doubled int
+	err = client.Call(context.Background(), "math.Double", 21, &doubled)
+	_assert(err == nil && doubled == 42, "expect 42, got %d, err %v", doubled, err)
+	var tenantName string
+	err = client.Call(AppendMetadata(context.Background(), "tenant", "bank-a"), "math.Tenant", 1, &tenantName)
+	_assert(err == nil && tenantName == "bank-a", "expect bank-a, got %q, err %v", tenantName, err)
+
+	_assert(s.Unregister("bank.v2.Foo") == nil, "failed to unregister bank.v2.Foo")
+	_assert(s.Unregister("bank.v2.Foo") != nil, "expect not found error")
+	err = client.Call(context.Background(), "bank.v2.Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect 3, got %d, err %v", sum, err)
+}
+
+// Blob 返回指定长度的数据
+type Blob int
+
+func (b Blob) Get(n int, reply *[]byte) error {
+	*reply = make([]byte, n)
+	return nil
+}
+
+// 单帧最大 4KB 的编解码类型，编解码类型不能重复注册，测试重复运行时只注册一次
+const smallFrameCodec codec.Type = "application/x-gbankrpc-test-small-frame"
+
+var registerSmallFrameCodec sync.Once
+
+func TestServer_ResponseTooLarge(t *testing.T) {
+	registerSmallFrameCodec.Do(func() {
+		_assert(codec.Register(smallFrameCodec, codec.NewFramedCodecFunc(codec.FramedOption{MaxFrameSize: 4096})) == nil,
+			"failed to register codec")
+	})
+
+	s := NewServer()
+	_assert(s.RegisterService(new(Blob)) == nil, "failed to register Blob")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+	defer s.Close()
+
+	client, err := Dial("tcp", ls.Addr().String(), &Option{CodecType: smallFrameCodec})
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply []byte
+	err = client.Call(context.Background(), "Blob.Get", 1<<16, &reply)
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect ResourceExhausted, got %v", err)
+	// 只有超限的请求失败，连接仍可继续使用
+	err = client.Call(context.Background(), "Blob.Get", 16, &reply)
+	_assert(err == nil && len(reply) == 16, "expect 16 bytes, got %d, err %v", len(reply), err)
+}
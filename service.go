@@ -1,9 +1,12 @@
 package GbankRPC
 
 import (
+	"GbankRPC/logging"
+	"context"
+	"fmt"
 	"go/ast"
-	"log"
 	"reflect"
+	runtimedebug "runtime/debug"
 	"sync/atomic"
 )
 
@@ -12,9 +15,21 @@ type MethodType struct {
 	Method    reflect.Method
 	ArgType   reflect.Type
 	ReplyType reflect.Type
-	callNums  uint64
+	// 方法的第一个入参是否为 context.Context
+	withContext bool
+	// 是否为通过 RegisterFunc 注册的普通函数，调用时不传入接收者
+	isFunc   bool
+	callNums uint64
+	// 方法执行过程中发生 panic 的次数
+	panicNums uint64
+	stats     methodStats
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 // NewArg 根据 ArgType 类型创建arg
 func (m *MethodType) NewArg() reflect.Value {
 	var arg reflect.Value
@@ -33,76 +48,105 @@ func (m *MethodType) NewReply() reflect.Value {
 
 	switch m.ReplyType.Elem().Kind() {
 	case reflect.Map:
-		reply.Set(reflect.MakeMap(m.ReplyType.Elem()))
+		reply.Elem().Set(reflect.MakeMap(m.ReplyType.Elem()))
 	case reflect.Slice:
-		reply.Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
+		reply.Elem().Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
 	}
 	return reply
 }
 
+// PanicHandler 服务方法发生 panic 时的回调，recovered 为 recover 的返回值，stack 为 panic 时的调用栈
+type PanicHandler func(ctx context.Context, serviceMethod string, recovered interface{}, stack []byte)
+
 // Service 服务实例
 type Service struct {
 	name    string
 	typ     reflect.Type
 	obj     reflect.Value
 	methods map[string]*MethodType
+	// 是否由 RegisterFunc 注册的函数组成
+	funcs bool
+	// 注册到服务端时由服务端设置，panicHandler 可为空
+	panicHandler PanicHandler
+	logger       logging.Logger
 }
 
 // NewService 通过传入的 struct 实例初始化service
 func NewService(obj interface{}) *Service {
+	return newTypeService(obj, logging.Default())
+}
+
+// 以 obj 的类型名称初始化service
+func newTypeService(obj interface{}, logger logging.Logger) *Service {
+	// 无法确定传入的 obj 是值类型还是指针类型，这里调用 Indirect 提取实例对象再获取名称
+	name := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	if !ast.IsExported(name) {
+		logger.Warn("rpc: service name is not exported", "service", name)
+	}
+	return newService(name, obj, logger)
+}
+
+// 以指定名称初始化service，注册方法时的日志写入 logger
+func newService(name string, obj interface{}, logger logging.Logger) *Service {
 	res := &Service{
-		// 无法确定传入的 obj 是值类型还是指针类型，这里调用 Indirect 提取实例对象再获取名称
-		name:    reflect.Indirect(reflect.ValueOf(obj)).Type().Name(),
+		name:    name,
 		typ:     reflect.TypeOf(obj),
 		obj:     reflect.ValueOf(obj),
 		methods: make(map[string]*MethodType),
+		logger:  logger,
 	}
-
-	if !ast.IsExported(res.name) {
-		log.Printf("NewService %s is not a valid service Name\n", res.name)
-	}
-
 	res.registerMethods()
 	return res
 }
 
 // 注册 service 中的可导出、内置方法
+// 支持 func(T, Arg, *Reply) error 与 func(T, context.Context, Arg, *Reply) error 两种签名
 func (s *Service) registerMethods() {
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i)
-
-		// 校验方法签名
-		if method.Type.NumIn() != 3 || method.Type.NumOut() != 1 {
-			log.Printf("registerMethods %s Method signature is not valid\n", method.Name)
-			continue
-		}
-		if method.Type.In(2).Kind() != reflect.Ptr {
-			log.Printf("registerMethods %s Method signature is not valid,in 2th should ptr\n", method.Name)
+		methodType, err := newMethodType(method, 1)
+		if err != nil {
+			s.logger.Warn("rpc: skip method", "service", s.name, "method", method.Name, "err", err)
 			continue
 		}
+		s.methods[method.Name] = methodType
+	}
+}
 
-		if method.Type.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
-			log.Printf("registerMethods %s Method signature is not valid,out should error\n", method.Name)
-			continue
-		}
+// 校验方法签名并创建 MethodType，recv 为 Arg 之前接收者参数的个数，结构体方法为 1，普通函数为 0
+func newMethodType(method reflect.Method, recv int) (*MethodType, error) {
+	withContext := method.Type.NumIn() == recv+3 && method.Type.In(recv) == typeOfContext
+	if (method.Type.NumIn() != recv+2 && !withContext) || method.Type.NumOut() != 1 {
+		return nil, fmt.Errorf("%s Method signature is not valid", method.Name)
+	}
+	argIndex := recv
+	if withContext {
+		argIndex++
+	}
 
-		// 判断两个入参是否是可导出方法或内置方法
-		argType, replyType := method.Type.In(1), method.Type.In(2)
-		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
-			log.Printf("registerMethods %s Method signature is not valid,in should be exported or builtin\n",
-				method.Name)
-			continue
-		}
+	if method.Type.In(argIndex+1).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("%s Method signature is not valid,reply should ptr", method.Name)
+	}
 
-		// 方法签名校验通过
-		methodType := &MethodType{
-			Method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
-			callNums:  uint64(0),
-		}
-		s.methods[method.Name] = methodType
+	if method.Type.Out(0) != typeOfError {
+		return nil, fmt.Errorf("%s Method signature is not valid,out should error", method.Name)
+	}
+
+	// 判断两个入参是否是可导出方法或内置方法
+	argType, replyType := method.Type.In(argIndex), method.Type.In(argIndex+1)
+	if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
+		return nil, fmt.Errorf("%s Method signature is not valid,in should be exported or builtin", method.Name)
 	}
+
+	// 方法签名校验通过
+	return &MethodType{
+		Method:      method,
+		ArgType:     argType,
+		ReplyType:   replyType,
+		withContext: withContext,
+		isFunc:      recv == 0,
+		callNums:    uint64(0),
+	}, nil
 }
 
 // 判断 t 是否是导出或内置类型
@@ -112,10 +156,32 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 
 // Call 调用指定方法
 func (s *Service) Call(m *MethodType, arg, reply reflect.Value) error {
+	return s.CallContext(context.Background(), m, arg, reply)
+}
+
+// CallContext 调用指定方法，方法签名包含 context.Context 时传入 ctx
+// 方法内的 panic 会被恢复并转换为 CodeInternal 错误返回，不会影响其他请求
+func (s *Service) CallContext(ctx context.Context, m *MethodType, arg, reply reflect.Value) (err error) {
 	atomic.AddUint64(&m.callNums, 1)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&m.panicNums, 1)
+			err = handlePanic(ctx, s.logger, s.name+"."+m.Method.Name, r, s.panicHandler)
+		}
+	}()
 	f := m.Method.Func
 	// 调用结构体的方法，Call的第一个参数需要是结构体实例，若是普通的方法则直接按序传入参数即可
-	returnValues := f.Call([]reflect.Value{s.obj, arg, reply})
+	in := []reflect.Value{arg, reply}
+	if m.withContext {
+		in = append([]reflect.Value{reflect.ValueOf(ctx)}, in...)
+	}
+	if !m.isFunc {
+		in = append([]reflect.Value{s.obj}, in...)
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
@@ -126,3 +192,19 @@ func (s *Service) Call(m *MethodType, arg, reply reflect.Value) error {
 func (m *MethodType) GetCallNums() uint64 {
 	return atomic.LoadUint64(&m.callNums)
 }
+
+// GetPanicNums 获取方法执行过程中发生 panic 的次数
+func (m *MethodType) GetPanicNums() uint64 {
+	return atomic.LoadUint64(&m.panicNums)
+}
+
+// 记录 panic 及调用栈，调用 handler 后返回给调用方的错误
+func handlePanic(ctx context.Context, logger logging.Logger, serviceMethod string, r interface{},
+	handler PanicHandler) error {
+	stack := runtimedebug.Stack()
+	logger.Error("rpc server: panic recovered", "method", serviceMethod, "panic", r, "stack", string(stack))
+	if handler != nil {
+		handler(ctx, serviceMethod, r, stack)
+	}
+	return Errorf(CodeInternal, "rpc server: panic in %s: %v", serviceMethod, r)
+}
@@ -1,7 +1,10 @@
 package GbankRPC
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -45,3 +48,72 @@ func TestMethodType_Call(t *testing.T) {
 	err := s.Call(mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.GetCallNums() == 1, "failed to call Foo.Sum")
 }
+
+type CtxFoo int
+
+func (f CtxFoo) Sum(ctx context.Context, args Args, reply *int) error {
+	if ctx == nil {
+		return errors.New("nil context")
+	}
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// the first argument isn't a context.Context
+func (f CtxFoo) Bad(name string, args Args, reply *int) error {
+	return nil
+}
+
+func TestService_ContextMethod(t *testing.T) {
+	s := NewService(new(CtxFoo))
+	_assert(len(s.methods) == 1, "wrong service Method, expect 1, but got %d", len(s.methods))
+	mType := s.methods["Sum"]
+	_assert(mType != nil && mType.withContext, "Sum should be registered as a context method")
+
+	argv := mType.NewArg()
+	replyv := mType.NewReply()
+	argv.Set(reflect.ValueOf(Args{Num1: 2, Num2: 3}))
+	err := s.CallContext(context.Background(), mType, argv, replyv)
+	_assert(err == nil && *replyv.Interface().(*int) == 5, "failed to call CtxFoo.Sum")
+	err = s.Call(mType, argv, replyv)
+	_assert(err == nil, "Call should pass a background context")
+}
+
+type PanicFoo int
+
+func (f PanicFoo) Divide(args Args, reply *int) error {
+	*reply = args.Num1 / args.Num2
+	return nil
+}
+
+func TestService_Panic(t *testing.T) {
+	var handled []string
+	s := NewServer(WithPanicHandler(func(ctx context.Context, serviceMethod string, r interface{}, stack []byte) {
+		handled = append(handled, serviceMethod)
+	}))
+	_assert(s.RegisterService(new(PanicFoo)) == nil, "failed to register PanicFoo")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	err = client.Call(context.Background(), "PanicFoo.Divide", Args{Num1: 1, Num2: 0}, &reply)
+	_assert(ErrorCode(err) == CodeInternal, "expect Internal, got %v", err)
+	// 发生 panic 后服务端及连接仍可用
+	err = client.Call(context.Background(), "PanicFoo.Divide", Args{Num1: 6, Num2: 3}, &reply)
+	_assert(err == nil && reply == 2, "expect 2, got %d, err %v", reply, err)
+
+	svc, mType, _ := s.findServiceMethod("PanicFoo.Divide")
+	_assert(mType.GetCallNums() == 2 && mType.GetPanicNums() == 1,
+		"expect 2 calls and 1 panic, got %d and %d", mType.GetCallNums(), mType.GetPanicNums())
+	_assert(len(handled) == 1 && handled[0] == "PanicFoo.Divide", "unexpected panic handler calls %v", handled)
+
+	// 直接调用 Service 同样恢复 panic
+	argv := mType.NewArg()
+	argv.Set(reflect.ValueOf(Args{Num1: 1}))
+	err = svc.Call(mType, argv, mType.NewReply())
+	_assert(ErrorCode(err) == CodeInternal, "expect Internal, got %v", err)
+}
@@ -0,0 +1,238 @@
+package GbankRPC
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 延迟直方图各个桶的上界
+var latencyBuckets = [...]time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Histogram 延迟直方图快照
+type Histogram struct {
+	// 各个桶的上界
+	Bounds []time.Duration
+	// Counts[i] 为延迟在 (Bounds[i-1], Bounds[i]] 内的请求数，最后一个元素为超过全部上界的请求数
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// 每个方法保留的最近错误数
+const maxRecentErrors = 10
+
+// RecentError 方法最近返回的错误
+type RecentError struct {
+	Time    time.Time
+	Code    Code
+	Message string
+}
+
+// MethodStats 单个方法的统计快照
+type MethodStats struct {
+	ServiceMethod string
+	// 处理完成的请求数
+	Calls uint64
+	// 正在处理的请求数
+	InFlight int64
+	// 按错误码统计的请求数，成功的请求计入 CodeOK
+	Codes map[Code]uint64
+	// 服务端处理超时或超过客户端截止时间的请求数
+	Timeouts uint64
+	Panics   uint64
+	// 请求及响应的字节数，请求字节数按读取请求期间连接上读取的字节数统计，
+	// 编解码器预读时为近似值；通过 ServeCodec 处理的连接不统计字节数
+	RequestBytes  uint64
+	ResponseBytes uint64
+	Latency       Histogram
+}
+
+// methodStats 方法的统计数据
+type methodStats struct {
+	inFlight int64
+
+	mu            sync.Mutex
+	calls         uint64
+	codes         map[Code]uint64
+	timeouts      uint64
+	requestBytes  uint64
+	responseBytes uint64
+	buckets       [len(latencyBuckets) + 1]uint64
+	latencySum    time.Duration
+	// 最近的错误，按时间顺序排列
+	recentErrors []RecentError
+}
+
+// 记录一次处理完成的请求，code 不为 CodeOK 时 errMsg 记入最近错误
+func (m *methodStats) record(code Code, errMsg string, latency time.Duration, timeout bool,
+	requestBytes, responseBytes uint64) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.codes == nil {
+		m.codes = make(map[Code]uint64)
+	}
+	m.codes[code]++
+	if timeout {
+		m.timeouts++
+	}
+	m.requestBytes += requestBytes
+	m.responseBytes += responseBytes
+	m.buckets[i]++
+	m.latencySum += latency
+
+	if code != CodeOK {
+		if len(m.recentErrors) == maxRecentErrors {
+			m.recentErrors = append(m.recentErrors[:0], m.recentErrors[1:]...)
+		}
+		m.recentErrors = append(m.recentErrors, RecentError{Time: time.Now(), Code: code, Message: errMsg})
+	}
+}
+
+// 统计快照，不包含 panic 次数
+func (m *methodStats) snapshot() MethodStats {
+	res := MethodStats{
+		InFlight: atomic.LoadInt64(&m.inFlight),
+		Codes:    make(map[Code]uint64),
+		Latency:  Histogram{Bounds: append([]time.Duration(nil), latencyBuckets[:]...)},
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res.Calls = m.calls
+	for code, n := range m.codes {
+		res.Codes[code] = n
+	}
+	res.Timeouts = m.timeouts
+	res.RequestBytes = m.requestBytes
+	res.ResponseBytes = m.responseBytes
+	res.Latency.Counts = append([]uint64(nil), m.buckets[:]...)
+	res.Latency.Count = m.calls
+	res.Latency.Sum = m.latencySum
+	return res
+}
+
+// 清空统计数据，正在处理的请求数不受影响
+func (m *methodStats) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = 0
+	m.codes = nil
+	m.timeouts = 0
+	m.requestBytes = 0
+	m.responseBytes = 0
+	m.buckets = [len(latencyBuckets) + 1]uint64{}
+	m.latencySum = 0
+	m.recentErrors = nil
+}
+
+// Stats 返回方法的统计快照
+func (m *MethodType) Stats() MethodStats {
+	res := m.stats.snapshot()
+	res.Panics = m.GetPanicNums()
+	return res
+}
+
+// RecentErrors 返回方法最近返回的错误，按时间顺序排列
+func (m *MethodType) RecentErrors() []RecentError {
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+	return append([]RecentError(nil), m.stats.recentErrors...)
+}
+
+// ResetStats 清空方法的统计数据及调用次数，正在处理的请求数不受影响
+func (m *MethodType) ResetStats() {
+	atomic.StoreUint64(&m.callNums, 0)
+	atomic.StoreUint64(&m.panicNums, 0)
+	m.stats.reset()
+}
+
+// Stats 返回服务全部方法的统计快照，按方法名排序
+func (s *Service) Stats() []MethodStats {
+	res := make([]MethodStats, 0, len(s.methods))
+	for name, m := range s.methods {
+		stats := m.Stats()
+		stats.ServiceMethod = s.name + "." + name
+		res = append(res, stats)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ServiceMethod < res[j].ServiceMethod })
+	return res
+}
+
+// ResetStats 清空服务全部方法的统计数据
+func (s *Service) ResetStats() {
+	for _, m := range s.methods {
+		m.ResetStats()
+	}
+}
+
+// UnknownServiceMethod 统计中未找到对应方法的请求使用的方法名
+const UnknownServiceMethod = "<unknown>"
+
+// Stats 返回全部已注册服务的方法统计快照，按 service.Method 排序
+// 存在未找到对应方法的请求时，额外包含以 UnknownServiceMethod 命名的统计
+func (s *Server) Stats() []MethodStats {
+	var res []MethodStats
+	s.serviceTable.Range(func(_, val interface{}) bool {
+		res = append(res, val.(*Service).Stats()...)
+		return true
+	})
+	if unknown := s.unknownStats.snapshot(); unknown.Calls > 0 {
+		unknown.ServiceMethod = UnknownServiceMethod
+		res = append(res, unknown)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ServiceMethod < res[j].ServiceMethod })
+	return res
+}
+
+// ResetStats 清空全部已注册服务的统计数据
+func (s *Server) ResetStats() {
+	s.serviceTable.Range(func(_, val interface{}) bool {
+		val.(*Service).ResetStats()
+		return true
+	})
+	s.unknownStats.reset()
+}
+
+// countingConn 统计连接上读写的字节数
+type countingConn struct {
+	io.ReadWriteCloser
+	read, written uint64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.read, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.written, uint64(n))
+	return n, err
+}
+
+// 已读取的字节数，c 为空时返回 0
+func (c *countingConn) bytesRead() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.read)
+}
+
+// 已写入的字节数，c 为空时返回 0
+func (c *countingConn) bytesWritten() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.written)
+}
@@ -0,0 +1,74 @@
+package GbankRPC
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_Stats(t *testing.T) {
+	s := NewServer(WithMaxHandleTimeout(50 * time.Millisecond))
+	_assert(s.RegisterService(new(Account)) == nil, "failed to register Account")
+	ls, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(ls)
+
+	client, err := Dial("tcp", ls.Addr().String(), nil)
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	for i := 0; i < 3; i++ {
+		_assert(client.Call(context.Background(), "Account.Withdraw", 10, &reply) == nil, "withdraw failed")
+	}
+	err = client.Call(context.Background(), "Account.Withdraw", 1000, &reply)
+	_assert(ErrorCode(err) == codeInsufficientFunds, "expect insufficient funds, got %v", err)
+	err = client.Call(context.Background(), "Account.Slow", 200, &reply)
+	_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+	// 在 serveConn 中被拒绝的请求同样记入统计
+	err = client.Call(context.Background(), "Account.Withdraw", "ten", &reply)
+	_assert(ErrorCode(err) == CodeInvalidArgument, "expect InvalidArgument, got %v", err)
+	err = client.Call(context.Background(), "Account.Missing", 10, &reply)
+	_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+
+	withdraw := waitStats(t, s, "Account.Withdraw", 5)
+	slow := waitStats(t, s, "Account.Slow", 1)
+	unknown := waitStats(t, s, UnknownServiceMethod, 1)
+	_assert(withdraw.Codes[CodeOK] == 3 && withdraw.Codes[codeInsufficientFunds] == 1 &&
+		withdraw.Codes[CodeInvalidArgument] == 1, "unexpected withdraw stats %+v", withdraw)
+	_assert(withdraw.Latency.Count == 5 && len(withdraw.Latency.Counts) == len(withdraw.Latency.Bounds)+1,
+		"unexpected latency %+v", withdraw.Latency)
+	_assert(withdraw.RequestBytes > 0 && withdraw.ResponseBytes > 0, "expect byte sizes recorded, got %+v", withdraw)
+	_assert(withdraw.InFlight == 0 && withdraw.Timeouts == 0, "unexpected withdraw stats %+v", withdraw)
+
+	_assert(slow.Calls == 1 && slow.Timeouts == 1 && slow.Codes[CodeDeadlineExceeded] == 1,
+		"unexpected slow stats %+v", slow)
+	_assert(slow.Latency.Sum >= 50*time.Millisecond, "expect latency of the timeout, got %s", slow.Latency.Sum)
+	_assert(unknown.Codes[CodeNotFound] == 1, "unexpected unknown method stats %+v", unknown)
+
+	s.ResetStats()
+	svc, mType, _ := s.findServiceMethod("Account.Withdraw")
+	st := mType.Stats()
+	_assert(st.Calls == 0 && len(st.Codes) == 0 && st.RequestBytes == 0 && mType.GetCallNums() == 0,
+		"expect reset stats, got %+v", st)
+	_assert(len(svc.Stats()) == 2, "expect 2 methods, got %d", len(svc.Stats()))
+	for _, st := range s.Stats() {
+		_assert(st.ServiceMethod != UnknownServiceMethod, "expect unknown method stats reset")
+	}
+}
+
+// 统计在回复发送后记录，等待方法处理完成的请求数达到 n
+func waitStats(t *testing.T, s *Server, serviceMethod string, n uint64) MethodStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, st := range s.Stats() {
+			if st.ServiceMethod == serviceMethod && (st.Calls >= n || time.Now().After(deadline)) {
+				_assert(st.Calls == n, "%s: expect %d calls, got %d", serviceMethod, n, st.Calls)
+				return st
+			}
+		}
+		_assert(time.Now().Before(deadline), "%s: no stats", serviceMethod)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
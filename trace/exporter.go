@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// InMemoryExporter 将 span 保存在内存中，用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter 新建 InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, *span)
+}
+
+// Spans 返回已导出的 span，按结束顺序排列
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset 清空已导出的 span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONLinesExporter 将每个 span 编码为一行 json 写入 w
+type JSONLinesExporter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+	// 写入失败后不再写入
+	err error
+}
+
+// NewJSONLinesExporter 新建写入 w 的 JSONLinesExporter
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{w: w, enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter 以追加方式打开 path，新建写入该文件的 JSONLinesExporter
+func NewFileExporter(path string) (*JSONLinesExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesExporter(f), nil
+}
+
+func (e *JSONLinesExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = e.enc.Encode(span)
+	}
+}
+
+// Err 返回写入过程中的第一个错误
+func (e *JSONLinesExporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Close w 实现了 io.Closer 时将其关闭
+func (e *JSONLinesExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
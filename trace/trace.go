@@ -0,0 +1,234 @@
+// Package trace 提供 rpc 调用的链路追踪：生成 span，以 W3C traceparent 格式在请求元数据中传递链路信息，
+// 并通过 SpanExporter 导出结束的 span。
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentKey 请求元数据中携带链路信息的 key
+const TraceparentKey = "traceparent"
+
+// TraceID 链路 ID
+type TraceID [16]byte
+
+// SpanID span ID
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// MarshalText 以十六进制编码
+func (t TraceID) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// MarshalText 以十六进制编码，无效的 ID 编码为空字符串
+func (s SpanID) MarshalText() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, nil
+	}
+	return []byte(s.String()), nil
+}
+
+// SpanContext 跨进程传递的链路信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// 是否采样，对应 traceparent 的 trace-flags
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 返回 W3C traceparent 格式的链路信息，如 00-<trace-id>-<span-id>-01
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var errInvalidTraceparent = errors.New("trace: invalid traceparent")
+
+// ParseTraceparent 解析 W3C traceparent 格式的链路信息
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceparent
+	}
+	// 版本 00 只有 4 段，更高的版本可能追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errInvalidTraceparent
+	}
+	if strings.ToLower(s) != s {
+		return sc, errInvalidTraceparent
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if !sc.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// SpanKind span 的类型
+type SpanKind string
+
+const (
+	SpanKindClient   SpanKind = "client"
+	SpanKindServer   SpanKind = "server"
+	SpanKindInternal SpanKind = "internal"
+)
+
+// SpanData 结束的 span，由 SpanExporter 导出
+type SpanData struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// 根 span 的父 span ID 编码为空字符串
+	ParentSpanID SpanID
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string `json:",omitempty"`
+	// 结果状态，rpc 调用为错误码名称，如 OK、DeadlineExceeded
+	StatusCode    string `json:",omitempty"`
+	StatusMessage string `json:",omitempty"`
+}
+
+// SpanExporter 导出结束的 span，需支持并发调用
+type SpanExporter interface {
+	ExportSpan(span *SpanData)
+}
+
+// Span 进行中的 span，End 之后的修改均被忽略
+type Span struct {
+	tracer *Tracer
+	// 继承自父 span，未采样的 span 只传递链路信息，结束时不导出
+	sampled bool
+	mu      sync.Mutex
+	data    SpanData
+	ended   bool
+}
+
+// SpanContext 返回 span 的链路信息
+func (s *Span) SpanContext() SpanContext {
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: s.sampled}
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetStatus 设置结果状态
+func (s *Span) SetStatus(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.StatusCode, s.data.StatusMessage = code, message
+}
+
+// End 结束 span 并导出，重复调用只导出一次，未采样的 span 不导出
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(&data)
+	}
+}
+
+// Tracer 创建 span 并在结束时交给 exporter 导出
+type Tracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer 新建 Tracer，exporter 为空时 span 不导出，链路信息仍会传递
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+type spanKey struct{}
+type remoteParentKey struct{}
+
+// ContextWithSpan 返回携带 span 的 ctx，之后在该 ctx 上创建的 span 均为其子 span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 返回 ctx 中的 span，不存在时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent 返回携带远端父 span 信息的 ctx，通常由服务端根据请求中的 traceparent 设置
+func ContextWithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, parent)
+}
+
+// SpanContextFromContext 返回 ctx 中 span 的链路信息，没有 span 时返回远端父 span 的链路信息
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext(), true
+	}
+	parent, ok := ctx.Value(remoteParentKey{}).(SpanContext)
+	return parent, ok && parent.IsValid()
+}
+
+// Start 创建 span，ctx 中有 span 或远端父 span 时作为其子 span 并沿用其采样标记，
+// 否则开始新的采样链路。返回的 ctx 携带新建的 span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{tracer: t, data: SpanData{Name: name, Kind: kind, Start: time.Now()}}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		span.data.TraceID = parent.TraceID
+		span.data.ParentSpanID = parent.SpanID
+		span.sampled = parent.Sampled
+	} else {
+		rand.Read(span.data.TraceID[:])
+		span.sampled = true
+	}
+	rand.Read(span.data.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
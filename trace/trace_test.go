@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Fatalf("expect %s, got %s", tp, got)
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("expect error for %q", s)
+		}
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer(exp)
+
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindClient)
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.SetAttribute("k", "v")
+	child.End()
+	child.End()
+	child.SetStatus("OK", "")
+	root.End()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].TraceID != spans[1].TraceID ||
+		spans[0].ParentSpanID != spans[1].SpanID || spans[1].ParentSpanID.IsValid() {
+		t.Fatalf("unexpected parent/child link %+v", spans)
+	}
+	if spans[0].Attributes["k"] != "v" || spans[0].StatusCode != "" {
+		t.Fatalf("unexpected child span %+v", spans[0])
+	}
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "server", SpanKindServer)
+	if span.data.TraceID != remote.TraceID || span.data.ParentSpanID != remote.SpanID {
+		t.Fatalf("expect child of remote parent, got %+v", span.data)
+	}
+	if !span.SpanContext().Sampled || !root.SpanContext().Sampled {
+		t.Fatal("expect sampled spans")
+	}
+
+	// 父 span 未采样时，子 span 传递未采样标记且不导出
+	exp.Reset()
+	unsampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span = tracer.Start(ContextWithRemoteParent(context.Background(), unsampled), "server", SpanKindServer)
+	_, child = tracer.Start(ctx, "child", SpanKindInternal)
+	if child.SpanContext().Sampled || child.SpanContext().TraceID != unsampled.TraceID {
+		t.Fatalf("expect unsampled child, got %+v", child.SpanContext())
+	}
+	child.End()
+	span.End()
+	if len(exp.Spans()) != 0 {
+		t.Fatalf("expect unsampled spans not exported, got %+v", exp.Spans())
+	}
+
+	exp.Reset()
+	if len(exp.Spans()) != 0 {
+		t.Fatal("expect no spans after Reset")
+	}
+}
+
+func TestJSONLinesExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewJSONLinesExporter(&buf))
+	ctx, root := tracer.Start(context.Background(), "root", SpanKindClient)
+	_, child := tracer.Start(ctx, "child", SpanKindServer)
+	child.SetStatus("Internal", "boom")
+	child.End()
+	root.End()
+
+	dec := json.NewDecoder(&buf)
+	var lines []map[string]interface{}
+	for dec.More() {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %d", len(lines))
+	}
+	if lines[0]["ParentSpanID"] != lines[1]["SpanID"] || lines[0]["StatusCode"] != "Internal" || lines[0]["Kind"] != "server" {
+		t.Fatalf("unexpected child line %v", lines[0])
+	}
+	if lines[1]["ParentSpanID"] != "" {
+		t.Fatalf("expect empty ParentSpanID for root span, got %v", lines[1])
+	}
+	if len(lines[1]["TraceID"].(string)) != 32 {
+		t.Fatalf("expect hex trace id, got %v", lines[1]["TraceID"])
+	}
+}
@@ -0,0 +1,81 @@
+package GbankRPC
+
+import (
+	"GbankRPC/trace"
+	"context"
+	"strconv"
+)
+
+// span 属性名
+const (
+	attrRPCMethod = "rpc.method"
+	attrRPCSeq    = "rpc.seq"
+	attrPeerAddr  = "net.peer.addr"
+)
+
+// WithTracer 设置服务端 Tracer，每个请求创建一个服务端 span，客户端携带 traceparent 时作为其子 span。
+// span 通过 ctx 传给服务方法，方法中使用该 ctx 发起的调用与其处于同一链路
+func WithTracer(tracer *trace.Tracer) ServerOption {
+	return func(s *Server) {
+		s.tracer = tracer
+	}
+}
+
+// 为请求创建服务端 span，未配置 Tracer 时只将请求中的链路信息放入 ctx 继续传递，返回的 span 为 nil
+func (s *Server) startSpan(ctx context.Context, sc *serverConn, req *Request) (context.Context, *trace.Span) {
+	if tp, ok := req.h.Metadata[trace.TraceparentKey]; ok {
+		if parent, err := trace.ParseTraceparent(tp); err == nil {
+			ctx = trace.ContextWithRemoteParent(ctx, parent)
+		}
+	}
+	if s.tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := s.tracer.Start(ctx, req.h.ServiceMethod, trace.SpanKindServer)
+	span.SetAttribute(attrRPCMethod, req.h.ServiceMethod)
+	span.SetAttribute(attrRPCSeq, strconv.FormatUint(req.h.Seq, 10))
+	if sc.remoteAddr != "" {
+		span.SetAttribute(attrPeerAddr, sc.remoteAddr)
+	}
+	return ctx, span
+}
+
+// 为调用创建客户端 span，未配置 Tracer 时返回的 span 为 nil
+func (c *Client) startSpan(ctx context.Context, serviceMethod string) (context.Context, *trace.Span) {
+	if c.opt.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := c.opt.Tracer.Start(ctx, serviceMethod, trace.SpanKindClient)
+	span.SetAttribute(attrRPCMethod, serviceMethod)
+	return ctx, span
+}
+
+// 以错误码结束 span，span 为 nil 时忽略
+func endSpan(span *trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.SetStatus(ErrorCode(err).String(), err.Error())
+	} else {
+		span.SetStatus(CodeOK.String(), "")
+	}
+	span.End()
+}
+
+// 返回加入 ctx 中链路信息后的请求元数据，请求元数据中已有 traceparent 时以其为准
+func injectTraceparent(ctx context.Context, md map[string]string) map[string]string {
+	sc, ok := trace.SpanContextFromContext(ctx)
+	if !ok {
+		return md
+	}
+	if _, exist := md[trace.TraceparentKey]; exist {
+		return md
+	}
+	res := make(map[string]string, len(md)+1)
+	for k, v := range md {
+		res[k] = v
+	}
+	res[trace.TraceparentKey] = sc.Traceparent()
+	return res
+}
@@ -0,0 +1,124 @@
+package GbankRPC
+
+import (
+	"GbankRPC/trace"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Relay 通过 client 将请求转发给 Foo
+type Relay struct {
+	client *Client
+}
+
+func (r *Relay) Sum(ctx context.Context, args Args, reply *int) error {
+	return r.client.Call(ctx, "Foo.Sum", args, reply)
+}
+
+func startTracedServer(t *testing.T, tracer *trace.Tracer, rcvr interface{}) string {
+	s := NewServer(WithTracer(tracer))
+	_assert(s.RegisterService(rcvr) == nil, "failed to register service")
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	go s.Accept(ls)
+	t.Cleanup(func() { s.Close() })
+	return ls.Addr().String()
+}
+
+// 服务端 span 在回复之后结束，等待 n 个 span 导出
+func waitSpans(t *testing.T, exp *trace.InMemoryExporter, n int) []trace.SpanData {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(exp.Spans()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	spans := exp.Spans()
+	_assert(len(spans) == n, "expect %d spans, got %d", n, len(spans))
+	return spans
+}
+
+func TestTracing(t *testing.T) {
+	exp := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exp)
+	fooAddr := startTracedServer(t, tracer, new(Foo))
+	fooClient, err := Dial("tcp", fooAddr, &Option{Tracer: tracer})
+	_assert(err == nil, "dial failed: %v", err)
+	defer fooClient.Close()
+	relayAddr := startTracedServer(t, tracer, &Relay{client: fooClient})
+
+	client, err := Dial("tcp", relayAddr, &Option{Tracer: tracer})
+	_assert(err == nil, "dial failed: %v", err)
+	defer client.Close()
+
+	var reply int
+	err = client.Call(context.Background(), "Relay.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call failed: %v", err)
+
+	spans := make(map[string]trace.SpanData)
+	for _, span := range waitSpans(t, exp, 4) {
+		spans[string(span.Kind)+" "+span.Name] = span
+	}
+	chain := []string{"client Relay.Sum", "server Relay.Sum", "client Foo.Sum", "server Foo.Sum"}
+	for i, name := range chain {
+		span, ok := spans[name]
+		_assert(ok, "missing span %s", name)
+		_assert(span.StatusCode == "OK", "span %s: expect OK, got %s", name, span.StatusCode)
+		if i == 0 {
+			_assert(!span.ParentSpanID.IsValid(), "span %s should be a root span", name)
+			continue
+		}
+		parent := spans[chain[i-1]]
+		_assert(span.TraceID == parent.TraceID && span.ParentSpanID == parent.SpanID,
+			"span %s is not a child of %s", name, chain[i-1])
+	}
+
+	t.Run("error", func(t *testing.T) {
+		exp.Reset()
+		err := client.Call(context.Background(), "Relay.Missing", Args{}, &reply)
+		_assert(ErrorCode(err) == CodeNotFound, "expect NotFound, got %v", err)
+		// 方法不存在时服务端同样创建 span，作为客户端 span 的子 span
+		spans := make(map[trace.SpanKind]trace.SpanData)
+		for _, span := range waitSpans(t, exp, 2) {
+			_assert(span.StatusCode == "NotFound", "unexpected span %+v", span)
+			spans[span.Kind] = span
+		}
+		client, server := spans[trace.SpanKindClient], spans[trace.SpanKindServer]
+		_assert(server.Name == "Relay.Missing" && server.ParentSpanID == client.SpanID,
+			"server span is not a child of client span: %+v", spans)
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		exp.Reset()
+		parent, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		// 上游未采样时整条链路均不导出
+		ctx := trace.ContextWithRemoteParent(context.Background(), parent)
+		err := client.Call(ctx, "Relay.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "call failed: %v", err)
+
+		// 随后的采样调用导出的 span 均不属于未采样的链路
+		err = client.Call(context.Background(), "Relay.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(err == nil && reply == 3, "call failed: %v", err)
+		for _, span := range waitSpans(t, exp, 4) {
+			_assert(span.TraceID != parent.TraceID, "unsampled span exported %+v", span)
+		}
+	})
+	t.Run("propagate without tracer", func(t *testing.T) {
+		exp.Reset()
+		plain, err := Dial("tcp", fooAddr, nil)
+		_assert(err == nil, "dial failed: %v", err)
+		defer plain.Close()
+
+		ctx, span := tracer.Start(context.Background(), "local", trace.SpanKindInternal)
+		err = plain.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 1}, &reply)
+		span.End()
+		_assert(err == nil, "call failed: %v", err)
+		spans := waitSpans(t, exp, 2)
+		for _, s := range spans {
+			if s.Kind == trace.SpanKindServer {
+				_assert(s.ParentSpanID == span.SpanContext().SpanID, "server span is not a child of local span")
+			}
+		}
+	})
+}
@@ -1,7 +1,7 @@
 package xclient
 
 import (
-	"log"
+	"GbankRPC/logging"
 	"net/http"
 	"strings"
 	"time"
@@ -15,6 +15,7 @@ type GBankRPCDiscovery struct {
 	lastUpdateTime time.Time
 	// 服务列表超时时间
 	timeout time.Duration
+	logger  logging.Logger
 }
 
 var defaultTimeout = time.Second * 10
@@ -28,9 +29,17 @@ func NewGBankRPCDiscovery(registryAddr string, timeout time.Duration) *GBankRPCD
 		MultiServerDiscovery: NewMultiServerDiscovery(make([]string, 0)),
 		registryAddr:         registryAddr,
 		timeout:              timeout,
+		logger:               logging.Nop(),
 	}
 }
 
+// SetLogger 设置从注册中心更新服务列表时的日志，默认丢弃全部日志
+func (g *GBankRPCDiscovery) SetLogger(logger logging.Logger) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logger = logging.OrNop(logger)
+}
+
 // Refresh 从注册中心更新服务列表
 func (g *GBankRPCDiscovery) Refresh() error {
 	g.mu.Lock()
@@ -41,11 +50,11 @@ func (g *GBankRPCDiscovery) Refresh() error {
 		return nil
 	}
 
-	log.Println("rpc registry: refresh servers from registry", g.registryAddr)
+	g.logger.Debug("rpc registry: refresh servers", "registry", g.registryAddr)
 
 	rsp, err := http.Get(g.registryAddr)
 	if err != nil {
-		log.Println("rpc registry refresh err:", err)
+		g.logger.Warn("rpc registry: refresh servers error", "registry", g.registryAddr, "err", err)
 		return err
 	}
 
@@ -58,6 +67,7 @@ func (g *GBankRPCDiscovery) Refresh() error {
 	}
 
 	g.lastUpdateTime = time.Now()
+	g.logger.Debug("rpc registry: servers refreshed", "registry", g.registryAddr, "servers", len(g.servers))
 	return nil
 }
 
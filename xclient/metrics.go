@@ -0,0 +1,45 @@
+package xclient
+
+import (
+	"GbankRPC/metrics"
+	"sort"
+)
+
+// WriteMetrics 输出各个节点的选中次数、连接失败次数及尚未收到结果的请求数
+func (x *XClient) WriteMetrics(w *metrics.Writer) {
+	x.mu.Lock()
+	picks := copyCounts(x.picks)
+	dialFailures := copyCounts(x.dialFailures)
+	pending := make(map[string]uint64, len(x.clients))
+	for addr, client := range x.clients {
+		pending[addr] = uint64(client.Pending())
+	}
+	x.mu.Unlock()
+
+	w.Header("gbankrpc_xclient_picks_total", metrics.TypeCounter, "Times an endpoint was picked by load balancing.")
+	writeEndpointSamples(w, "gbankrpc_xclient_picks_total", picks)
+	w.Header("gbankrpc_xclient_dial_failures_total", metrics.TypeCounter, "Failed dials to an endpoint.")
+	writeEndpointSamples(w, "gbankrpc_xclient_dial_failures_total", dialFailures)
+	w.Header("gbankrpc_xclient_pending_calls", metrics.TypeGauge, "Calls sent to an endpoint and waiting for a reply.")
+	writeEndpointSamples(w, "gbankrpc_xclient_pending_calls", pending)
+}
+
+func copyCounts(m map[string]uint64) map[string]uint64 {
+	res := make(map[string]uint64, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// 按节点地址排序输出
+func writeEndpointSamples(w *metrics.Writer, name string, counts map[string]uint64) {
+	endpoints := make([]string, 0, len(counts))
+	for endpoint := range counts {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		w.Sample(name, float64(counts[endpoint]), "endpoint", endpoint)
+	}
+}
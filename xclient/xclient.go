@@ -2,6 +2,7 @@ package xclient
 
 import (
 	"GbankRPC"
+	"GbankRPC/logging"
 	"context"
 	"reflect"
 	"sync"
@@ -13,10 +14,38 @@ type XClient struct {
 	mode      SelectMode
 	opt       *GbankRPC.Option
 	clients   map[string]*GbankRPC.Client
+	// opt 中配置的拦截器，由 XClient 在每次调用节点时执行，不再传给各节点的客户端
+	interceptor GbankRPC.ClientInterceptor
+	// 按节点统计的负载均衡选中次数及连接失败次数
+	picks        map[string]uint64
+	dialFailures map[string]uint64
+	// opt 中配置的日志，同时传给各节点的客户端
+	logger logging.Logger
 }
 
+// XClient 可作为 GbankRPC.Invoke 等泛型调用方法的 Caller
+var _ GbankRPC.Caller = (*XClient)(nil)
+
 func NewXClient(discovery Discovery, mode SelectMode, opt *GbankRPC.Option) *XClient {
-	return &XClient{discovery: discovery, mode: mode, opt: opt, clients: make(map[string]*GbankRPC.Client)}
+	x := &XClient{
+		discovery:    discovery,
+		mode:         mode,
+		opt:          opt,
+		clients:      make(map[string]*GbankRPC.Client),
+		picks:        make(map[string]uint64),
+		dialFailures: make(map[string]uint64),
+		logger:       logging.Nop(),
+	}
+	if opt != nil {
+		x.logger = logging.OrNop(opt.Logger)
+	}
+	if opt != nil && len(opt.Interceptors) > 0 {
+		x.interceptor = GbankRPC.ChainClientInterceptors(opt.Interceptors...)
+		clientOpt := *opt
+		clientOpt.Interceptors = nil
+		x.opt = &clientOpt
+	}
+	return x
 }
 
 func (x *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
@@ -25,17 +54,26 @@ func (x *XClient) Call(ctx context.Context, serviceMethod string, args, reply in
 	if err != nil {
 		return err
 	}
+	x.mu.Lock()
+	x.picks[addr]++
+	x.mu.Unlock()
 
 	return x.call(ctx, addr, serviceMethod, args, reply)
 }
 
 func (x *XClient) call(ctx context.Context, addr, serviceMethod string, args, reply interface{}) error {
-	client, err := x.dial(addr)
-	if err != nil {
-		return err
+	invoker := func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+		client, err := x.dial(addr)
+		if err != nil {
+			return err
+		}
+		return client.Call(ctx, serviceMethod, args, reply)
 	}
 
-	return client.Call(ctx, serviceMethod, args, reply)
+	if x.interceptor != nil {
+		return x.interceptor(ctx, serviceMethod, args, reply, invoker)
+	}
+	return invoker(ctx, serviceMethod, args, reply)
 }
 
 // 根据地址匹配可达的客户端
@@ -53,6 +91,8 @@ func (x *XClient) dial(addr string) (*GbankRPC.Client, error) {
 	if client == nil {
 		newClient, err := GbankRPC.XDial(addr, x.opt)
 		if err != nil {
+			x.dialFailures[addr]++
+			x.logger.Warn("rpc xclient: dial error", "addr", addr, "err", err)
 			return nil, err
 		}
 		client = newClient
@@ -72,6 +112,7 @@ func (x *XClient) Broadcast(ctx context.Context, serviceMethod string, arg, repl
 
 	// 调用时产生错误，终止全部调用
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for _, serverAddr := range servers {
 		wg.Add(1)
 		go func(addr string) {
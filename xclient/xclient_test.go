@@ -0,0 +1,76 @@
+package xclient
+
+import (
+	"GbankRPC"
+	"GbankRPC/metrics"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Foo int
+
+func (f Foo) Sum(args [2]int, reply *int) error {
+	*reply = args[0] + args[1]
+	return nil
+}
+
+func startServer(t *testing.T) string {
+	s := GbankRPC.NewServer()
+	if err := s.RegisterService(new(Foo)); err != nil {
+		t.Fatal(err)
+	}
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Accept(ls)
+	t.Cleanup(func() { s.Close() })
+	return "tcp@" + ls.Addr().String()
+}
+
+func TestXClient(t *testing.T) {
+	addr := startServer(t)
+
+	var intercepted []string
+	opt := *GbankRPC.DefaultOption
+	opt.Interceptors = []GbankRPC.ClientInterceptor{
+		func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker GbankRPC.Invoker) error {
+			intercepted = append(intercepted, serviceMethod)
+			return invoker(ctx, serviceMethod, args, reply)
+		},
+	}
+	x := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, &opt)
+	defer x.Close()
+
+	sum, err := GbankRPC.Invoke[[2]int, int](context.Background(), x, "Foo.Sum", [2]int{1, 2})
+	if err != nil || sum != 3 {
+		t.Fatalf("expect 3, got %d, err %v", sum, err)
+	}
+	if len(intercepted) != 1 || intercepted[0] != "Foo.Sum" {
+		t.Errorf("unexpected intercepted calls %v", intercepted)
+	}
+
+	// 不可达的节点计入连接失败次数
+	x.discovery.Update([]string{"tcp@127.0.0.1:1"})
+	if err := x.Call(context.Background(), "Foo.Sum", [2]int{1, 2}, &sum); err == nil {
+		t.Fatal("expect dial error")
+	}
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	x.WriteMetrics(w)
+	w.Flush()
+	for _, line := range []string{
+		`gbankrpc_xclient_picks_total{endpoint="` + addr + `"} 1`,
+		`gbankrpc_xclient_picks_total{endpoint="tcp@127.0.0.1:1"} 1`,
+		`gbankrpc_xclient_dial_failures_total{endpoint="tcp@127.0.0.1:1"} 1`,
+		`gbankrpc_xclient_pending_calls{endpoint="` + addr + `"} 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}